@@ -2,7 +2,9 @@ package protoquery
 
 import (
 	"fmt"
+	"math"
 	reflect "reflect"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
@@ -63,29 +65,159 @@ func findFieldByName(msg proto.Message, name string) (protoreflect.FieldDescript
 }
 
 func toBool(v any) (bool, error) {
+	// A node set is truthy if it is not empty.
+	if ns, ok := v.(NodeSet); ok {
+		return len(ns) > 0, nil
+	}
 	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Bool {
 		return rv.Bool(), nil
 	}
 	return false, fmt.Errorf("not a bool: %v", v)
 }
 
+// scalarValue converts a protobuf scalar value into an expression value
+// and returns it along with the expression type. The well-known messages
+// are unwrapped (see wellKnownValue).
+func scalarValue(v any) (any, Type, bool) {
+	switch vv := v.(type) {
+	case bool:
+		return vv, TypeBool, true
+	case string:
+		return vv, TypeString, true
+	case int32:
+		return int64(vv), TypeInt, true
+	case int64:
+		return vv, TypeInt, true
+	case uint32:
+		return uint64(vv), TypeUint, true
+	case uint64:
+		return vv, TypeUint, true
+	case float32:
+		return float64(vv), TypeFloat, true
+	case float64:
+		return vv, TypeFloat, true
+	case []byte:
+		return vv, TypeBytes, true
+	case protoreflect.EnumNumber:
+		return int64(vv), TypeInt, true
+	case time.Time:
+		return vv, TypeTimestamp, true
+	case time.Duration:
+		return vv, TypeDuration, true
+	case protoreflect.Message:
+		return wellKnownValue(vv)
+	case proto.Message:
+		return wellKnownValue(vv.ProtoReflect())
+	}
+	return nil, TypeUnknown, false
+}
+
+// bindValue normalizes the bound variable value (see Bind). Scalars are
+// normalized the same way as scalarValue does, enums are represented by their
+// names. Lists and slices of scalars are turned into node sets of detached
+// values.
+func bindValue(v any) (any, Type, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, TypeUnknown, fmt.Errorf("%w: nil value", ErrInvalidType)
+	case NodeSet:
+		return vv, TypeNodeSet, nil
+	case []Node:
+		return NodeSet(vv), TypeNodeSet, nil
+	case protoreflect.Enum:
+		ev := vv.Descriptor().Values().ByNumber(vv.Number())
+		if ev == nil {
+			return nil, TypeUnknown, fmt.Errorf("%w: unknown %v value %d", ErrInvalidType, vv.Descriptor().FullName(), vv.Number())
+		}
+		return string(ev.Name()), TypeString, nil
+	case protoreflect.List:
+		ns := make(NodeSet, 0, vv.Len())
+		for i := 0; i < vv.Len(); i++ {
+			ns = append(ns, valueNode(vv.Get(i)))
+		}
+		return ns, TypeNodeSet, nil
+	}
+	if sv, typ, ok := scalarValue(v); ok {
+		return sv, typ, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch {
+	case isIntKind(rv):
+		return rv.Int(), TypeInt, nil
+	case isUintKind(rv):
+		return rv.Uint(), TypeUint, nil
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		ns := make(NodeSet, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ev, _, err := bindValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, TypeUnknown, err
+			}
+			if _, ok := ev.(NodeSet); ok {
+				return nil, TypeUnknown, fmt.Errorf("%w: nested lists are not supported", ErrInvalidType)
+			}
+			if msg, ok := wellKnownMessage(ev); ok {
+				// Time values are held by the well-known messages.
+				ev = msg
+			}
+			ns = append(ns, valueNode(protoreflect.ValueOf(ev)))
+		}
+		return ns, TypeNodeSet, nil
+	}
+	return nil, TypeUnknown, fmt.Errorf("%w: unsupported value type %T", ErrInvalidType, v)
+}
+
+func isUintKind(rv reflect.Value) bool {
+	k := rv.Kind()
+	return k == reflect.Uint || k == reflect.Uint8 || k == reflect.Uint16 || k == reflect.Uint32 || k == reflect.Uint64
+}
+
 func isIntKind(rv reflect.Value) bool {
 	k := rv.Kind()
 	return k == reflect.Int || k == reflect.Int8 || k == reflect.Int16 || k == reflect.Int32 || k == reflect.Int64
 }
 
+// toInt64 converts a signed or an unsigned integer to int64. It fails if the
+// value does not fit.
 func toInt64(v any) (int64, error) {
-	if rv := reflect.ValueOf(v); isIntKind(rv) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case isIntKind(rv):
 		return rv.Int(), nil
+	case isUintKind(rv):
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return 0, fmt.Errorf("%w: %v overflows int64", ErrInvalidType, v)
 	}
 	return 0, fmt.Errorf("not an int: %v", v)
 }
 
+// toUint64 converts an unsigned or a non-negative signed integer to uint64.
+func toUint64(v any) (uint64, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case isUintKind(rv):
+		return rv.Uint(), nil
+	case isIntKind(rv):
+		if i := rv.Int(); i >= 0 {
+			return uint64(i), nil
+		}
+		return 0, fmt.Errorf("%w: %v overflows uint64", ErrInvalidType, v)
+	}
+	return 0, fmt.Errorf("not an uint: %v", v)
+}
+
 func isFloatKind(rv reflect.Value) bool {
 	k := rv.Kind()
 	return k == reflect.Float32 || k == reflect.Float64
 }
 
+func isFloat32(v any) bool {
+	_, ok := v.(float32)
+	return ok
+}
+
 func toFloat64(v any) (float64, error) {
 	if rv := reflect.ValueOf(v); isFloatKind(rv) {
 		return rv.Float(), nil
@@ -120,85 +252,43 @@ func castToProtoreflectKind(v any, kind protoreflect.Kind) (any, bool) {
 		default:
 			return nil, false
 		}
-	case int:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(int)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(int)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(int)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(int)), true
-		default:
-			return nil, false
-		}
-	case int32:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(int32)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(int32)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(int32)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(int32)), true
-		default:
-			return nil, false
-		}
-	case int64:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(int64)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(int64)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(int64)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(int64)), true
-		default:
+	case int, int32, int64, uint, uint32, uint64:
+		return castIntToProtoreflectKind(v, kind)
+	// TODO(osdrv): implement me
+	default:
+		return nil, false
+	}
+}
+
+// castIntToProtoreflectKind casts the integer to the Go type of the integer
+// kind. It returns false if the value is out of the kind range, e.g.: a
+// negative value for an unsigned kind.
+func castIntToProtoreflectKind(v any, kind protoreflect.Kind) (any, bool) {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := toInt64(v)
+		if err != nil || i < math.MinInt32 || i > math.MaxInt32 {
 			return nil, false
 		}
-	case uint:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(uint)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(uint)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(uint)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(uint)), true
-		default:
+		return int32(i), true
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := toInt64(v)
+		if err != nil {
 			return nil, false
 		}
-	case uint32:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(uint32)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(uint32)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(uint32)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(uint32)), true
-		default:
+		return i, true
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := toUint64(v)
+		if err != nil || u > math.MaxUint32 {
 			return nil, false
 		}
-	case uint64:
-		switch kind {
-		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
-			return int32(v.(uint64)), true
-		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
-			return int64(v.(uint64)), true
-		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
-			return uint32(v.(uint64)), true
-		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
-			return uint64(v.(uint64)), true
-		default:
+		return uint32(u), true
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := toUint64(v)
+		if err != nil {
 			return nil, false
 		}
-	// TODO(osdrv): implement me
+		return u, true
 	default:
 		return nil, false
 	}
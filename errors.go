@@ -0,0 +1,45 @@
+package protoquery
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrFieldNotFound   = errors.New("Field not found")
+	ErrInvalidType     = errors.New("Invalid type")
+	ErrTypeMismatch    = errors.New("Type mismatch")
+	ErrKeyCast         = errors.New("Key cast failed")
+	ErrUnsupportedKey  = errors.New("Unsupported key")
+	ErrLimitExceeded   = errors.New("Limit exceeded")
+	ErrInvalidArgs     = errors.New("Invalid arguments")
+	ErrInvalidRegex    = errors.New("Invalid regular expression")
+	ErrUnknownFunction = errors.New("Unknown function")
+	ErrUnboundVariable = errors.New("Unbound variable")
+	ErrDivisionByZero  = errors.New("Division by zero")
+	ErrOverflow        = errors.New("Integer overflow")
+)
+
+// EvalError is an error raised by a query step evaluation.
+// It carries the failing step and the path of the value the step was applied to.
+type EvalError struct {
+	Step QueryStep
+	Path string
+	Err  error
+}
+
+var _ error = (*EvalError)(nil)
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("step %s at %s: %s", e.Step, e.Path, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// isBenign returns true if the error is a part of the normal evaluation flow
+// and should not be reported. Unset properties simply do not match.
+func isBenign(err error) bool {
+	return errors.Is(err, PropNotSet) && !errors.Is(err, ErrFieldNotFound)
+}
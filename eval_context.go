@@ -1,5 +1,11 @@
 package protoquery
 
+import (
+	"time"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+)
+
 type EvalOption func(EvalContext)
 
 func WithUseDefault(useDefault bool) EvalOption {
@@ -14,6 +20,50 @@ func WithEnforceBool(enforceBool bool) EvalOption {
 	}
 }
 
+// WithRoot sets the root message of the queried document. It is required
+// to evaluate the absolute paths within expressions, e.g.: `$root/people`.
+func WithRoot(root protoreflect.Message) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().root = root
+	}
+}
+
+// WithOneBasedPositions switches the positional functions (position(),
+// first(), last()) and the list indices to XPath 1-based positions.
+func WithOneBasedPositions(oneBased bool) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().OneBasedPositions = oneBased
+	}
+}
+
+// WithSize sets the size of the list an indexed context element belongs to.
+func WithSize(size int) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().size = size
+	}
+}
+
+// withSchema sets the static type of the context value.
+func withSchema(node schemaNode) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().schema = &node
+	}
+}
+
+// WithNow sets the time returned by now(). It defaults to the current time.
+func WithNow(now time.Time) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().now = now
+	}
+}
+
+// withVariables sets the variables bound to the query evaluation.
+func withVariables(vars map[string]boundVar) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().vars = vars
+	}
+}
+
 type EvalOptions struct {
 	// UseDefault is used to determine if the default value should be returned if
 	// the protobuf message property is not set.
@@ -21,10 +71,48 @@ type EvalOptions struct {
 	// EnforceBool is a flag indicating that instead of returning the actual property
 	// value, the expression should check its presence in the context message.
 	EnforceBool bool
+	// OneBasedPositions is a flag indicating that the positions are 1-based
+	// like in XPath. They are 0-based otherwise.
+	OneBasedPositions bool
+	// size is the size of the list an indexed context element belongs to.
+	size int
+	// root is the root message of the queried document.
+	root protoreflect.Message
+	// scope is the query evaluation scope of the context value. It is set by
+	// the query evaluator and is required to evaluate path expressions.
+	scope *evalScope
+	// vars are the variables bound to the query evaluation (see Bind).
+	vars map[string]boundVar
+	// now is the time returned by now(), see WithNow.
+	now time.Time
+	// schema is the static type of the context value. It is only set to
+	// type-check the expressions at compile time (see CompileFor).
+	schema *schemaNode
+}
+
+// boundVar is a normalized variable value along with its type.
+type boundVar struct {
+	value any
+	typ   Type
+}
+
+// evalScope binds an evaluation context to the query evaluation state.
+type evalScope struct {
+	ev   *evaluator
+	item queueItem
+}
+
+func withScope(ev *evaluator, item queueItem) EvalOption {
+	return func(ctx EvalContext) {
+		ctx.Options().scope = &evalScope{ev: ev, item: item}
+	}
 }
 
 type EvalContext interface {
 	This() any
+	// Root returns the root message of the queried document. It is nil
+	// unless the context is created with WithRoot.
+	Root() protoreflect.Message
 	Options() *EvalOptions
 	Copy(opts ...EvalOption) EvalContext
 }
@@ -32,6 +120,9 @@ type EvalContext interface {
 type IndexedEvalContext interface {
 	EvalContext
 	Index() int
+	// Size returns the size of the list the element belongs to. It is 0
+	// unless the context is created with WithSize.
+	Size() int
 }
 
 type EvalContextImpl struct {
@@ -56,12 +147,32 @@ func (ctx *EvalContextImpl) This() any {
 	return ctx.this
 }
 
+func (ctx *EvalContextImpl) Root() protoreflect.Message {
+	return ctx.opts.root
+}
+
 func (ctx *EvalContextImpl) Options() *EvalOptions {
 	return ctx.opts
 }
 
 func (ctx *EvalContextImpl) Copy(opts ...EvalOption) EvalContext {
-	return NewEvalContext(ctx.This(), opts...)
+	// The query-wide options and the evaluation scope are inherited by the copy.
+	cp := &EvalContextImpl{
+		this: ctx.this,
+		opts: &EvalOptions{
+			OneBasedPositions: ctx.opts.OneBasedPositions,
+			size:              ctx.opts.size,
+			root:              ctx.opts.root,
+			scope:             ctx.opts.scope,
+			vars:              ctx.opts.vars,
+			now:               ctx.opts.now,
+			schema:            ctx.opts.schema,
+		},
+	}
+	for _, opt := range opts {
+		opt(cp)
+	}
+	return cp
 }
 
 type IndexedEvalContextImpl struct {
@@ -82,6 +193,10 @@ func (ctx *IndexedEvalContextImpl) Index() int {
 	return ctx.index
 }
 
+func (ctx *IndexedEvalContextImpl) Size() int {
+	return ctx.Options().size
+}
+
 func (ctx *IndexedEvalContextImpl) Copy(opts ...EvalOption) EvalContext {
 	return &IndexedEvalContextImpl{
 		EvalContext: ctx.EvalContext.Copy(opts...),
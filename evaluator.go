@@ -0,0 +1,861 @@
+package protoquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unsafe"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FindOption configures a single query evaluation.
+type FindOption func(*findOptions)
+
+type findOptions struct {
+	// strict indicates that the evaluation should terminate on the first error.
+	strict bool
+	// warnings collects the evaluation errors in non-strict mode.
+	warnings *[]error
+	// maxResults limits the number of yielded results. 0 means no limit.
+	maxResults int
+	// maxVisitedNodes limits the number of visited nodes. 0 means no limit.
+	maxVisitedNodes int
+	// maxDepth limits the message nesting depth. 0 means no limit.
+	maxDepth int
+	// maxQueueMemory limits the estimated memory footprint of the
+	// evaluation queue in bytes. 0 means no limit.
+	maxQueueMemory int
+	// oneBased indicates that the positions are 1-based (see WithXPathPositions).
+	oneBased bool
+	// bindings are the raw variable values (see Bind).
+	bindings map[string]any
+	// vars are the normalized variable values.
+	vars map[string]boundVar
+	// clock returns the current time for now() (see WithClock).
+	clock func() time.Time
+	// now is the clock reading shared by the whole evaluation.
+	now time.Time
+}
+
+// WithStrict turns the evaluation errors into hard failures: the evaluation
+// terminates on the first error.
+func WithStrict(strict bool) FindOption {
+	return func(opts *findOptions) {
+		opts.strict = strict
+	}
+}
+
+// WithWarnings collects the evaluation errors in non-strict mode.
+// Every collected error is an *EvalError.
+func WithWarnings(warnings *[]error) FindOption {
+	return func(opts *findOptions) {
+		opts.warnings = warnings
+	}
+}
+
+// WithMaxResults stops the evaluation as soon as n results are collected.
+// Unlike the other limits, reaching it is not an error.
+func WithMaxResults(n int) FindOption {
+	return func(opts *findOptions) {
+		opts.maxResults = n
+	}
+}
+
+// WithMaxVisitedNodes terminates the evaluation with ErrLimitExceeded
+// once more than n nodes are visited.
+func WithMaxVisitedNodes(n int) FindOption {
+	return func(opts *findOptions) {
+		opts.maxVisitedNodes = n
+	}
+}
+
+// WithMaxDepth terminates the evaluation with ErrLimitExceeded once the
+// evaluation descends deeper than n nested messages.
+func WithMaxDepth(n int) FindOption {
+	return func(opts *findOptions) {
+		opts.maxDepth = n
+	}
+}
+
+// WithMaxQueueMemory terminates the evaluation with ErrLimitExceeded once the
+// estimated memory footprint of the evaluation queue exceeds n bytes.
+func WithMaxQueueMemory(n int) FindOption {
+	return func(opts *findOptions) {
+		opts.maxQueueMemory = n
+	}
+}
+
+// WithClock sets the clock read by now(). The clock is read once per
+// evaluation, so every now() call of the evaluation returns the same time.
+// It defaults to time.Now.
+func WithClock(clock func() time.Time) FindOption {
+	return func(opts *findOptions) {
+		opts.clock = clock
+	}
+}
+
+// Bind binds the value to the query variable, e.g.: Bind("name", "John")
+// for `/people[@name = $name]`. The value is either a scalar (bool, string,
+// integer, float, enum or a wrapper message), a time (a time.Time, a time.Duration or their
+// well-known messages), nodes (a NodeSet or a []Node) or a list of
+// scalars (a slice or a protoreflect.List). Lists are compared element-wise
+// like node sets. The evaluation fails upfront if any of the query variables
+// is not bound.
+func Bind(name string, value any) FindOption {
+	return func(opts *findOptions) {
+		if opts.bindings == nil {
+			opts.bindings = make(map[string]any)
+		}
+		opts.bindings[name] = value
+	}
+}
+
+// prepare reads the clock and normalizes the bound variable values. It fails
+// if any of the query variables is not bound.
+func (opts *findOptions) prepare(vars []string) error {
+	clock := opts.clock
+	if clock == nil {
+		clock = time.Now
+	}
+	opts.now = clock()
+	return opts.bindVariables(vars)
+}
+
+// bindVariables normalizes the bound variable values.
+func (opts *findOptions) bindVariables(vars []string) error {
+	for _, name := range vars {
+		if _, ok := opts.bindings[name]; !ok {
+			return fmt.Errorf("%w: $%v", ErrUnboundVariable, name)
+		}
+	}
+	if len(opts.bindings) == 0 {
+		return nil
+	}
+	opts.vars = make(map[string]boundVar, len(opts.bindings))
+	for name, v := range opts.bindings {
+		if name == "root" {
+			return fmt.Errorf("%w: variable $root is reserved", ErrInvalidArgs)
+		}
+		value, typ, err := bindValue(v)
+		if err != nil {
+			return fmt.Errorf("variable $%v: %w", name, err)
+		}
+		opts.vars[name] = boundVar{value: value, typ: typ}
+	}
+	return nil
+}
+
+// queryVariables returns the names of the variables the query refers to.
+func queryVariables(pq *ProtoQuery) []string {
+	var names []string
+	collect := func(e Expression) error {
+		if v, ok := e.(*VariableExpr); ok && !slices.Contains(names, v.name) {
+			names = append(names, v.name)
+		}
+		return nil
+	}
+	if pq.expr != nil {
+		walkExpr(pq.expr, collect)
+		return names
+	}
+	for _, path := range pq.tree.paths() {
+		walkQueryExprs(path, collect)
+	}
+	return names
+}
+
+// walk performs the query traversal and calls yield on every matching item.
+// The traversal terminates as soon as yield returns false.
+func (pq *ProtoQuery) walk(ctx context.Context, root proto.Message, yield func(queueItem) bool, opts ...FindOption) error {
+	if DEBUG {
+		debugf("Query: %s", pq)
+	}
+
+	if root == nil {
+		return nil
+	}
+	if pq.tree == nil {
+		return fmt.Errorf("Expression query %v does not select values, use Evaluate", pq.expr)
+	}
+	if err := pq.checkRoot(root); err != nil {
+		return err
+	}
+
+	fopts := &findOptions{oneBased: pq.oneBased}
+	for _, opt := range opts {
+		opt(fopts)
+	}
+	if err := fopts.prepare(pq.vars); err != nil {
+		return err
+	}
+	start := rootItem(root.ProtoReflect())
+	// A single path is streamed, the set operations need complete node sets.
+	if pq.tree.isPath() {
+		return newEvaluator(ctx, pq.tree.path, fopts, root.ProtoReflect()).run(start, yield)
+	}
+	items, err := evalQueryTree(ctx, pq.tree, fopts, start)
+	if err != nil {
+		return err
+	}
+	for i, qi := range items {
+		if !yield(qi) {
+			return nil
+		}
+		if fopts.maxResults > 0 && i+1 >= fopts.maxResults {
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkRoot validates the root message type against the bound descriptor (see CompileFor).
+func (pq *ProtoQuery) checkRoot(root proto.Message) error {
+	if pq.md != nil && pq.md.FullName() != root.ProtoReflect().Descriptor().FullName() {
+		return fmt.Errorf("%w: query is bound to %v, got %v", ErrTypeMismatch,
+			pq.md.FullName(), root.ProtoReflect().Descriptor().FullName())
+	}
+	return nil
+}
+
+// evalQueryTree evaluates the query tree against the start item. The result
+// is deduplicated and sorted in the document order.
+func evalQueryTree(ctx context.Context, tree *QueryTree, opts *findOptions, start queueItem) ([]queueItem, error) {
+	if tree.isPath() {
+		return collect(ctx, tree.path, opts, start.ptr.Message(), start)
+	}
+	left, err := evalQueryTree(ctx, tree.left, opts, start)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalQueryTree(ctx, tree.right, opts, start)
+	if err != nil {
+		return nil, err
+	}
+	// Items are identified by their location in the root message.
+	rkeys := make(map[string]struct{}, len(right))
+	for _, qi := range right {
+		rkeys[qi.path.String()] = struct{}{}
+	}
+	var items []queueItem
+	switch tree.op {
+	case SetUnion:
+		items = append(left, right...)
+	case SetIntersect, SetExcept:
+		for _, qi := range left {
+			if _, ok := rkeys[qi.path.String()]; ok == (tree.op == SetIntersect) {
+				items = append(items, qi)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Invalid set operator %v", tree.op)
+	}
+	slices.SortStableFunc(items, func(a, b queueItem) int {
+		return comparePaths(a.path, b.path)
+	})
+	return slices.CompactFunc(items, func(a, b queueItem) bool {
+		return comparePaths(a.path, b.path) == 0
+	}), nil
+}
+
+// rootItem returns the queue item pointing to the document root.
+func rootItem(root protoreflect.Message) queueItem {
+	return queueItem{
+		qix: 0,
+		ptr: protoreflect.ValueOf(root),
+	}
+}
+
+// collect evaluates the query against the start item and returns all the matching items.
+func collect(ctx context.Context, query Query, opts *findOptions, root protoreflect.Message, start queueItem) ([]queueItem, error) {
+	// The results limit only applies to the final result.
+	cp := *opts
+	cp.maxResults = 0
+	start.qix = 0
+	items := []queueItem{}
+	err := newEvaluator(ctx, query, &cp, root).run(start, func(qi queueItem) bool {
+		items = append(items, qi)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// evaluator keeps the state of a single query evaluation.
+type evaluator struct {
+	ctx   context.Context
+	query Query
+	opts  *findOptions
+	queue *QueueOnce[qmemkey, queueItem]
+	// root is the root message of the queried document.
+	root protoreflect.Message
+	// absolutes caches the absolute path expression results.
+	absolutes map[*PathExpr]NodeSet
+	// sets caches the membership test sets that do not depend on the
+	// context value (see InExpr).
+	sets map[*InExpr]*ListExpr
+}
+
+func newEvaluator(ctx context.Context, query Query, opts *findOptions, root protoreflect.Message) *evaluator {
+	return &evaluator{
+		ctx:   ctx,
+		query: query,
+		opts:  opts,
+		queue: NewQueueOnce[qmemkey, queueItem](),
+		root:  root,
+	}
+}
+
+func (ev *evaluator) run(start queueItem, yield func(queueItem) bool) error {
+	ev.queue.Push(start)
+
+	var head queueItem
+	visited, results := 0, 0
+	for ev.queue.Len() > 0 {
+		select {
+		case <-ev.ctx.Done():
+			return ev.ctx.Err()
+		default:
+		}
+		if err := ev.checkQueueMemory(); err != nil {
+			return err
+		}
+		head = ev.queue.Pop()
+		visited++
+		if ev.opts.maxVisitedNodes > 0 && visited > ev.opts.maxVisitedNodes {
+			return fmt.Errorf("%w: more than %d nodes visited", ErrLimitExceeded, ev.opts.maxVisitedNodes)
+		}
+		if ev.opts.maxDepth > 0 && head.depth > ev.opts.maxDepth {
+			return fmt.Errorf("%w: depth %d exceeds %d at %s", ErrLimitExceeded, head.depth, ev.opts.maxDepth, head.path)
+		}
+		// We've reached the end of the query, so we can append the current pointer to the result.
+		if head.qix >= len(ev.query) {
+			for _, qi := range head.flat() {
+				if !yield(qi) {
+					return nil
+				}
+				results++
+				if ev.opts.maxResults > 0 && results >= ev.opts.maxResults {
+					return nil
+				}
+			}
+			continue
+		}
+		step := ev.query[head.qix]
+		if DEBUG {
+			debugf("-> current pointer: %s", printProtoVal(head.ptr))
+			debugf("~> step: %s", step)
+		}
+		var err error
+		switch step.Kind() {
+		case RootQueryStepKind:
+			debugf("Root step: %s", step)
+			ev.queue.Push(head.next())
+		case NodeQueryStepKind:
+			debugf("Node step: %s", step)
+			err = ev.evalNodeStep(head, step.(*NodeQueryStep))
+		case KeyQueryStepKind:
+			debugf("KeyQuery step: %s", step)
+			err = ev.evalKeyStep(head, step.(*KeyQueryStep))
+		case RecursiveDescentQueryStepKind:
+			debugf("Recursive descent step: %s", step)
+			ev.evalRecursiveDescentStep(head)
+		case SelfQueryStepKind:
+			debugf("Self step: %s", step)
+			ev.queue.Push(head.next())
+		case ParentQueryStepKind:
+			debugf("Parent step: %s", step)
+			ev.evalParentStep(head)
+		default:
+			panicf("Query step %q(kind=%v) is not supported", step.String(), step.Kind())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalOptions returns the expression evaluation options for the item.
+func (ev *evaluator) evalOptions(item queueItem, opts ...EvalOption) []EvalOption {
+	return append(opts,
+		withScope(ev, item),
+		WithRoot(ev.root),
+		WithOneBasedPositions(ev.opts.oneBased),
+		withVariables(ev.opts.vars),
+		WithNow(ev.opts.now),
+	)
+}
+
+// listSize returns the size of the list holding the item. It is 0 if the
+// item is not a list element.
+func (ev *evaluator) listSize(item queueItem) int {
+	if item.parent == nil || item.descr == nil || !item.descr.IsList() {
+		return 0
+	}
+	msg, ok := toMessage(item.parent.ptr)
+	if !ok {
+		return 0
+	}
+	return msg.Get(item.descr).List().Len()
+}
+
+// checkQueueMemory estimates the memory footprint of the queue and terminates
+// the evaluation if it exceeds the limit.
+func (ev *evaluator) checkQueueMemory() error {
+	if ev.opts.maxQueueMemory <= 0 {
+		return nil
+	}
+	size := ev.queue.Len()*int(unsafe.Sizeof(queueItem{})+unsafe.Sizeof(pathElem{})) +
+		ev.queue.MemoLen()*int(unsafe.Sizeof(qmemkey{}))
+	if size > ev.opts.maxQueueMemory {
+		return fmt.Errorf("%w: queue memory %d bytes exceeds %d bytes", ErrLimitExceeded, size, ev.opts.maxQueueMemory)
+	}
+	return nil
+}
+
+// fail reports an evaluation error. In strict mode it returns the error that
+// terminates the evaluation. Otherwise the error is collected as a warning.
+func (ev *evaluator) fail(head queueItem, step QueryStep, err error) error {
+	debugf("Step %s at %s: %s", step, head.path, err)
+	if isBenign(err) {
+		return nil
+	}
+	everr := &EvalError{
+		Step: step,
+		Path: head.path.String(),
+		Err:  err,
+	}
+	if ev.opts.strict {
+		return everr
+	}
+	if ev.opts.warnings != nil {
+		*ev.opts.warnings = append(*ev.opts.warnings, everr)
+	}
+	return nil
+}
+
+func (ev *evaluator) evalNodeStep(head queueItem, step *NodeQueryStep) error {
+	for _, c := range head.flat() {
+		if msg, ok := toMessage(c.ptr); ok {
+			fds := matchMsgFields(msg, step.name)
+			if len(fds) == 0 && ev.homogeneous(head.qix) {
+				// An unknown field trivially selects nothing, but we want to
+				// keep the distinction for the strict evaluation mode.
+				err := fmt.Errorf("%w: %v in %v", ErrFieldNotFound, step.name, msg.Descriptor().FullName())
+				if err := ev.fail(c, step, err); err != nil {
+					return err
+				}
+			}
+			for _, fd := range fds {
+				if isWrapperField(fd) && !msg.Has(fd) {
+					// An unset wrapper is a null scalar: there is no value to select.
+					continue
+				}
+				val := msg.Get(fd)
+				if fd.Kind() == protoreflect.EnumKind {
+					if e, ok := enumStr(fd, val); ok {
+						val = protoreflect.ValueOfString(e)
+					}
+				}
+				ev.queue.Push(c.field(head.qix+1, fd, val))
+			}
+		} else {
+			debugf("Node step: %s: not a message, skipping", step)
+		}
+	}
+	return nil
+}
+
+// homogeneous returns true if the values the query step at qix is applied to
+// are all of the same type. The values selected by a recursive descent or a
+// wildcard are heterogeneous: a node step is not expected to match all of them.
+func (ev *evaluator) homogeneous(qix int) bool {
+	for _, step := range ev.query[:qix] {
+		switch st := step.(type) {
+		case *RecursiveDescentQueryStep:
+			return false
+		case *NodeQueryStep:
+			if st.name == "*" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ev *evaluator) evalKeyStep(head queueItem, ks *KeyQueryStep) error {
+	if !ev.homogeneous(head.qix) && hasProperties(ks.expr) && !holdsMessages(head) {
+		// The property predicates only apply to the messages and the lists of
+		// messages among the values selected by a recursive descent or a
+		// wildcard, the rest are skipped.
+		return nil
+	}
+	if list, ok := toList(head.ptr); ok {
+		return ev.evalListKeyStep(head, ks, list)
+	} else if mp, ok := toMap(head.ptr); ok {
+		return ev.evalMapKeyStep(head, ks, mp)
+	} else if bytes, ok := toBytes(head.ptr); ok {
+		return ev.evalBytesKeyStep(head, ks, bytes)
+	} else if str, ok := head.ptr.Interface().(string); ok {
+		return ev.evalStringKeyStep(head, ks, str)
+	} else if msg, ok := toMessage(head.ptr); ok {
+		return ev.evalMessageKeyStep(head, ks, msg)
+	}
+	debugf("Current pointer: %s", printProtoVal(head.ptr))
+	return ev.fail(head, ks, fmt.Errorf("%w: key step is not supported for %T", ErrUnsupportedKey, head.ptr.Interface()))
+}
+
+// holdsMessages returns true if the value is a message or a list of messages.
+func holdsMessages(qi queueItem) bool {
+	if isMessage(qi.ptr) {
+		return true
+	}
+	return isList(qi.ptr) && qi.descr != nil && qi.descr.Kind() == protoreflect.MessageKind
+}
+
+// failPredicate reports the predicate evaluation error like fail does. The
+// messages selected by a recursive descent or a wildcard are heterogeneous:
+// a message without the property is not selected rather than reported.
+func (ev *evaluator) failPredicate(head queueItem, ks *KeyQueryStep, err error) error {
+	if errors.Is(err, ErrFieldNotFound) && !ev.homogeneous(head.qix) {
+		return nil
+	}
+	return ev.fail(head, ks, err)
+}
+
+func (ev *evaluator) evalListKeyStep(head queueItem, ks *KeyQueryStep, list protoreflect.List) error {
+	// TODO(osdrv): we can pre-compute isAllPropertyExprs as a property
+	// of the query, rather than doing it on the go.
+	// isAllPropertyExprs would check if the key only consists of
+	// attribute properties. I.e. it only checks if these properties
+	// are present in the message.
+	// E.g. [@foo && @bar && @baz]
+	enforceBool := isAllPropertyExprs(ks.expr)
+	ctx := NewEvalContext(list, ev.evalOptions(head, WithEnforceBool(enforceBool))...)
+	var typ Type
+	switch ks.mode {
+	case keyModeFilter:
+		typ = TypeBool
+	case keyModeIndex:
+		typ = TypeInt
+	case keyModeSlice:
+		typ = TypeSlice
+	default:
+		var err error
+		typ, err = ks.expr.Type(ctx)
+		if err != nil {
+			return ev.failPredicate(head, ks, err)
+		}
+	}
+	switch typ {
+	// Grep mode
+	case TypeBool:
+		// 1. Initialize a new list to store the intermediate results.
+		// 2. The list should have the same signature as the original list.
+		// 3. Populate the new list with the matching elements.
+		// 4. Append the new list to the queue.
+		tl := NewTmpList(head.descr)
+		for i := 0; i < list.Len(); i++ {
+			el := head.elem(head.qix, list.Get(i), originIndex(list, i))
+			ctxel := NewIndexedEvalContext(
+				list.Get(i).Interface(),
+				i,
+				ev.evalOptions(el, WithEnforceBool(enforceBool), WithSize(list.Len()))...,
+			)
+			v, err := ks.expr.Eval(ctxel)
+			if err == nil {
+				var pick bool
+				if pick, err = toBool(v); err == nil && pick {
+					tl.appendAt(list.Get(i), originIndex(list, i))
+				}
+			}
+			if err != nil {
+				if err := ev.failPredicate(el, ks, err); err != nil {
+					return err
+				}
+			}
+		}
+		if tl.Len() > 0 {
+			// The type descriptor and the lineage won't change: lists have identical signatures.
+			next := head.next()
+			next.ptr = protoreflect.ValueOf(tl)
+			ev.queue.Push(next)
+		}
+	// Index mode
+	case TypeInt, TypeUint:
+		v, err := ks.expr.Eval(ctx)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		ix, err := toInt64(v)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		if i, ok := ev.index(ix, list.Len()); ok {
+			ev.queue.Push(head.elem(head.qix+1, list.Get(i), originIndex(list, i)))
+		}
+	// Slice mode
+	case TypeSlice:
+		sb, err := ev.slice(ctx, ks)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		tl := NewTmpList(head.descr)
+		for _, i := range sb.indices(list.Len()) {
+			tl.appendAt(list.Get(i), originIndex(list, i))
+		}
+		if tl.Len() > 0 {
+			next := head.next()
+			next.ptr = protoreflect.ValueOf(tl)
+			ev.queue.Push(next)
+		}
+	default:
+		return ev.fail(head, ks, fmt.Errorf("%w: unsupported list key type %s", ErrUnsupportedKey, TypeToStr[typ]))
+	}
+	return nil
+}
+
+func (ev *evaluator) evalMapKeyStep(head queueItem, ks *KeyQueryStep, mp protoreflect.Map) error {
+	ctx := NewEvalContext(mp, ev.evalOptions(head)...)
+	k, err := ks.expr.Eval(ctx)
+	if err != nil {
+		return ev.fail(head, ks, err)
+	}
+	if head.descr == nil {
+		debugf("No information about map key type, trying the raw value")
+	} else {
+		if !head.descr.IsMap() {
+			return ev.fail(head, ks, fmt.Errorf("%w: unexpected descriptor kind: want protoreflect.Map, got %v", ErrUnsupportedKey, head.descr.Kind()))
+		}
+		keyKind := head.descr.MapKey().Kind()
+		ck, ok := castToProtoreflectKind(k, keyKind)
+		if !ok {
+			return ev.fail(head, ks, fmt.Errorf("%w: can not cast value %+v to protoreflect.Kind=%v", ErrKeyCast, k, keyKind))
+		}
+		k = ck
+	}
+	exprval := protoreflect.ValueOf(k)
+	key := exprval.MapKey()
+	if mp.Has(key) {
+		ev.queue.Push(head.entry(head.qix+1, mp.Get(key), key))
+	}
+	return nil
+}
+
+func (ev *evaluator) evalBytesKeyStep(head queueItem, ks *KeyQueryStep, bytes []byte) error {
+	ctx := NewEvalContext(head.ptr, ev.evalOptions(head)...)
+	typ, err := ks.expr.Type(ctx)
+	if err != nil {
+		return ev.fail(head, ks, err)
+	}
+	switch typ {
+	case TypeInt, TypeUint:
+		k, err := ks.expr.Eval(ctx)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		ix, err := toInt64(k)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		if i, ok := ev.index(ix, len(bytes)); ok {
+			// protoreflect does not support any ints below 32bits, hence the type casting
+			ev.queue.Push(head.elem(head.qix+1, protoreflect.ValueOf(uint32(bytes[i])), i))
+		}
+	case TypeSlice:
+		sb, err := ev.slice(ctx, ks)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		// Like in Python, an empty slice is an empty value rather than no
+		// value: b'abc'[5:] is b''.
+		sub := []byte{}
+		ix := sb.indices(len(bytes))
+		for _, i := range ix {
+			sub = append(sub, bytes[i])
+		}
+		ev.queue.Push(head.slice(head.qix+1, protoreflect.ValueOfBytes(sub), ix))
+	default:
+		return ev.fail(head, ks, fmt.Errorf("%w: unsupported bytes key type %s", ErrUnsupportedKey, TypeToStr[typ]))
+	}
+	return nil
+}
+
+// evalStringKeyStep indexes and slices the string by runes.
+func (ev *evaluator) evalStringKeyStep(head queueItem, ks *KeyQueryStep, str string) error {
+	ctx := NewEvalContext(head.ptr, ev.evalOptions(head)...)
+	typ, err := ks.expr.Type(ctx)
+	if err != nil {
+		return ev.fail(head, ks, err)
+	}
+	runes := []rune(str)
+	switch typ {
+	case TypeInt, TypeUint:
+		k, err := ks.expr.Eval(ctx)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		ix, err := toInt64(k)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		if i, ok := ev.index(ix, len(runes)); ok {
+			ev.queue.Push(head.elem(head.qix+1, protoreflect.ValueOfString(string(runes[i])), i))
+		}
+	case TypeSlice:
+		sb, err := ev.slice(ctx, ks)
+		if err != nil {
+			return ev.fail(head, ks, err)
+		}
+		// An empty slice is an empty string rather than no value.
+		var sub []rune
+		ix := sb.indices(len(runes))
+		for _, i := range ix {
+			sub = append(sub, runes[i])
+		}
+		ev.queue.Push(head.slice(head.qix+1, protoreflect.ValueOfString(string(sub)), ix))
+	default:
+		return ev.fail(head, ks, fmt.Errorf("%w: unsupported string key type %s", ErrUnsupportedKey, TypeToStr[typ]))
+	}
+	return nil
+}
+
+// index resolves the index of a sequence element: negative indices count
+// from the end. It returns false if the index is out of range.
+func (ev *evaluator) index(ix int64, n int) (int, bool) {
+	switch {
+	case ix < 0:
+		ix += int64(n)
+	case ev.opts.oneBased:
+		if ix == 0 {
+			return 0, false
+		}
+		ix--
+	}
+	if ix < 0 || ix >= int64(n) {
+		return 0, false
+	}
+	return int(ix), true
+}
+
+// slice evaluates the slice key.
+func (ev *evaluator) slice(ctx EvalContext, ks *KeyQueryStep) (sliceBounds, error) {
+	v, err := ks.expr.Eval(ctx)
+	if err != nil {
+		return sliceBounds{}, err
+	}
+	sb, ok := v.(sliceBounds)
+	if !ok {
+		return sliceBounds{}, fmt.Errorf("%w: %v is not a slice", ErrInvalidType, ks.expr)
+	}
+	return sb, nil
+}
+
+func (ev *evaluator) evalMessageKeyStep(head queueItem, ks *KeyQueryStep, msg protoreflect.Message) error {
+	// We always enforce bool context on a message.
+	var ctx EvalContext
+	if head.path != nil && head.path.index >= 0 {
+		// The message is a list element, e.g. reached by a recursive descent
+		// or an index step, so the positional functions are defined.
+		ctx = NewIndexedEvalContext(msg, head.path.index, ev.evalOptions(head, WithSize(ev.listSize(head)))...)
+	} else {
+		ctx = NewEvalContext(msg, ev.evalOptions(head)...)
+	}
+	v, err := ks.expr.Eval(ctx)
+	if err != nil {
+		return ev.failPredicate(head, ks, err)
+	}
+	pick, err := toBool(v)
+	if err != nil {
+		return ev.fail(head, ks, err)
+	}
+	if pick {
+		ev.queue.Push(head.next())
+	}
+	return nil
+}
+
+func (ev *evaluator) evalRecursiveDescentStep(head queueItem) {
+	if msg, ok := toMessage(head.ptr); ok {
+		// test the message itself
+		ev.queue.Push(head.next())
+		// recurse over all the fields
+		for _, fd := range matchMsgFields(msg, "*") {
+			if canRecurse(msg.Get(fd)) {
+				// preserve the recursive descent query step
+				ev.queue.Push(head.field(head.qix, fd, msg.Get(fd)))
+			}
+		}
+	} else if list, ok := toList(head.ptr); ok {
+		for i := 0; i < list.Len(); i++ {
+			if canRecurse(list.Get(i)) {
+				// preserve the recursive descent query step
+				ev.queue.Push(head.elem(head.qix, list.Get(i), originIndex(list, i)))
+			}
+		}
+	} else if mp, ok := toMap(head.ptr); ok {
+		mp.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			if canRecurse(value) {
+				// preserve the recursive descent query step
+				ev.queue.Push(head.entry(head.qix, value, key))
+			}
+			return true
+		})
+	} else {
+		debugf("RecursiveDescentQuery is not implemented for %+v", head.ptr.Interface())
+	}
+}
+
+// evalParentStep moves the pointer to the message containing the value.
+// The root message has no parent, so does an empty list.
+func (ev *evaluator) evalParentStep(head queueItem) {
+	if head.parent == nil || len(head.flat()) == 0 {
+		return
+	}
+	parent := *head.parent
+	parent.qix = head.qix + 1
+	ev.queue.Push(parent)
+}
+
+// subquery evaluates the query against the start item and returns the
+// matching nodes. It shares the evaluation context and the error reporting
+// options with the enclosing evaluation.
+func (ev *evaluator) subquery(query Query, start queueItem) (NodeSet, error) {
+	return collectNodes(ev.ctx, query, ev.opts, ev.root, start)
+}
+
+// absolute evaluates the absolute path expression. The result does not depend
+// on the context value, hence it is computed once per evaluation.
+func (ev *evaluator) absolute(p *PathExpr) (NodeSet, error) {
+	if ns, ok := ev.absolutes[p]; ok {
+		return ns, nil
+	}
+	ns, err := ev.subquery(p.query, rootItem(ev.root))
+	if err != nil {
+		return nil, err
+	}
+	if ev.absolutes == nil {
+		ev.absolutes = make(map[*PathExpr]NodeSet)
+	}
+	ev.absolutes[p] = ns
+	return ns, nil
+}
+
+// collectNodes is similar to collect but it returns the items as nodes.
+func collectNodes(ctx context.Context, query Query, opts *findOptions, root protoreflect.Message, start queueItem) (NodeSet, error) {
+	items, err := collect(ctx, query, opts, root, start)
+	if err != nil {
+		return nil, err
+	}
+	res := make(NodeSet, 0, len(items))
+	for _, qi := range items {
+		res = append(res, Node{item: qi})
+	}
+	return res, nil
+}
@@ -1,8 +1,19 @@
 package protoquery
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 )
@@ -16,19 +27,41 @@ const (
 	TypeInt
 	TypeFloat
 	TypeEnum
+	TypeNodeSet
+	TypeSlice
+	TypeUint
+	TypeBytes
+	TypeTimestamp
+	TypeDuration
 )
 
 var (
 	TypeToStr = map[Type]string{
-		TypeUnknown: "unknown",
-		TypeBool:    "bool",
-		TypeString:  "string",
-		TypeInt:     "int",
-		TypeFloat:   "float",
-		TypeEnum:    "enum",
+		TypeUnknown:   "unknown",
+		TypeBool:      "bool",
+		TypeString:    "string",
+		TypeInt:       "int",
+		TypeFloat:     "float",
+		TypeEnum:      "enum",
+		TypeNodeSet:   "nodeset",
+		TypeSlice:     "slice",
+		TypeUint:      "uint",
+		TypeBytes:     "bytes",
+		TypeTimestamp: "timestamp",
+		TypeDuration:  "duration",
 	}
 )
 
+// isIntegerType returns true for the signed and the unsigned integer types.
+func isIntegerType(typ Type) bool {
+	return typ == TypeInt || typ == TypeUint
+}
+
+// isNumericType returns true for the integer and the float types.
+func isNumericType(typ Type) bool {
+	return isIntegerType(typ) || typ == TypeFloat
+}
+
 type Operator uint8
 
 const (
@@ -46,6 +79,8 @@ const (
 	OpAnd
 	OpOr
 	OpNot
+	OpMatch
+	OpMod
 )
 
 var OpToStr = map[Operator]string{
@@ -62,26 +97,97 @@ var OpToStr = map[Operator]string{
 	OpAnd:   "&&",
 	OpOr:    "||",
 	OpNot:   "!",
+	OpMatch: "=~",
+	OpMod:   "%",
 }
 
 type Builtin struct {
 	body func(ctx EvalContext, args []Expression) (any, error)
 	typ  Type
+	// typeOf returns the result type if it depends on the arguments.
+	typeOf func(ctx EvalContext, args []Expression) (Type, error)
+	// args is the list of the argument types. TypeUnknown stands for any type.
+	args []Type
+	// optional is the number of the trailing optional arguments.
+	optional int
+	// variadic indicates that the last argument could be repeated.
+	variadic bool
 }
 
 func (b *Builtin) Call(ctx EvalContext, args []Expression) (any, error) {
 	return b.body(ctx, args)
 }
 
+// checkArgs validates the number of the arguments and their types.
+// The argument types are only validated in an element context: the
+// properties of a list context can not be resolved.
+func (b *Builtin) checkArgs(ctx EvalContext, handle string, args []Expression) error {
+	if err := b.checkArity(handle, args); err != nil {
+		return err
+	}
+	if _, ok := ctx.This().(protoreflect.List); ok {
+		return nil
+	}
+	ctx = ctx.Copy(WithEnforceBool(false))
+	for i, arg := range args {
+		want := b.args[min(i, len(b.args)-1)]
+		if want == TypeUnknown {
+			continue
+		}
+		typ, err := arg.Type(ctx)
+		if err != nil {
+			return err
+		}
+		if !argTypeFits(typ, want) {
+			return fmt.Errorf("%w %v for argument %d of %v(), want %v", ErrInvalidType, TypeToStr[typ], i+1, handle, TypeToStr[want])
+		}
+	}
+	return nil
+}
+
+// checkArity validates the number of the arguments.
+func (b *Builtin) checkArity(handle string, args []Expression) error {
+	if min := len(b.args) - b.optional; len(args) < min || (!b.variadic && len(args) > len(b.args)) {
+		return fmt.Errorf("%w: %v() got %d arguments", ErrInvalidArgs, handle, len(args))
+	}
+	return nil
+}
+
+// argTypeFits returns true if a value of the given type could be passed
+// as a function argument of the wanted type.
+func argTypeFits(typ, want Type) bool {
+	switch {
+	case typ == want, typ == TypeNodeSet:
+		return true
+	case want == TypeString:
+		return typ == TypeEnum
+	case want == TypeFloat:
+		return isIntegerType(typ)
+	case want == TypeInt:
+		return typ == TypeUint
+	}
+	return false
+}
+
 var (
 	builtins = map[string]Builtin{
+		"now": {
+			// now() returns the evaluation time, see WithClock.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				if now := ctx.Options().now; !now.IsZero() {
+					return now, nil
+				}
+				return time.Now(), nil
+			},
+			typ: TypeTimestamp,
+		},
 		"length": {
 			body: func(ctx EvalContext, args []Expression) (any, error) {
 				list, ok := ctx.This().(protoreflect.List)
 				if !ok {
 					return nil, fmt.Errorf("length() is only supported for repeated fields")
 				}
-				return list.Len(), nil
+				return int64(list.Len()), nil
 			},
 			typ: TypeInt,
 		},
@@ -91,13 +197,621 @@ var (
 				if !ok {
 					return nil, fmt.Errorf("position() expects an indexed context")
 				}
-				return ictx.Index(), nil
+				return int64(ictx.Index() + positionBase(ctx)), nil
+			},
+			typ: TypeInt,
+		},
+		"contains": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args)
+				if err != nil {
+					return nil, err
+				}
+				return strings.Contains(ss[0], ss[1]), nil
+			},
+			typ:  TypeBool,
+			args: []Type{TypeString, TypeString},
+		},
+		"starts-with": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args)
+				if err != nil {
+					return nil, err
+				}
+				return strings.HasPrefix(ss[0], ss[1]), nil
+			},
+			typ:  TypeBool,
+			args: []Type{TypeString, TypeString},
+		},
+		"ends-with": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args)
+				if err != nil {
+					return nil, err
+				}
+				return strings.HasSuffix(ss[0], ss[1]), nil
+			},
+			typ:  TypeBool,
+			args: []Type{TypeString, TypeString},
+		},
+		"substring": {
+			// substring(s, start[, length]) operates on runes. The start
+			// position follows the position base, see WithOneBasedPositions.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				s, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				start, err := intArg(ctx, args[1])
+				if err != nil {
+					return nil, err
+				}
+				runes := []rune(s)
+				n := int64(len(runes))
+				start -= int64(positionBase(ctx))
+				end := n
+				if len(args) > 2 {
+					length, err := intArg(ctx, args[2])
+					if err != nil {
+						return nil, err
+					}
+					// The length is clamped first: start + length could overflow.
+					switch {
+					case length <= 0:
+						end = start
+					case start < 0 || length < n-start:
+						end = start + length
+					}
+				}
+				start = max(0, min(start, n))
+				end = max(start, min(end, n))
+				return string(runes[start:end]), nil
+			},
+			typ:      TypeString,
+			args:     []Type{TypeString, TypeInt, TypeInt},
+			optional: 1,
+		},
+		"string-length": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				s, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return int64(utf8.RuneCountInString(s)), nil
+			},
+			typ:  TypeInt,
+			args: []Type{TypeString},
+		},
+		"concat": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args)
+				if err != nil {
+					return nil, err
+				}
+				return strings.Join(ss, ""), nil
+			},
+			typ:      TypeString,
+			args:     []Type{TypeString, TypeString},
+			variadic: true,
+		},
+		"lower": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				s, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return strings.ToLower(s), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeString},
+		},
+		"upper": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				s, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return strings.ToUpper(s), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeString},
+		},
+		"trim": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				s, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return strings.TrimSpace(s), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeString},
+		},
+		"replace": {
+			// replace(s, old, new) replaces all the occurrences of the substring.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args)
+				if err != nil {
+					return nil, err
+				}
+				return strings.ReplaceAll(ss[0], ss[1], ss[2]), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeString, TypeString, TypeString},
+		},
+		"split-part": {
+			// split-part(s, sep, n) returns the n-th part of the string split
+			// by the separator, or an empty string if there is no such part.
+			// The part number follows the position base, see WithOneBasedPositions.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ss, err := stringArgs(ctx, args[:2])
+				if err != nil {
+					return nil, err
+				}
+				n, err := intArg(ctx, args[2])
+				if err != nil {
+					return nil, err
+				}
+				parts := strings.Split(ss[0], ss[1])
+				n -= int64(positionBase(ctx))
+				if n < 0 || n >= int64(len(parts)) {
+					return "", nil
+				}
+				return parts[n], nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeString, TypeString, TypeInt},
+		},
+		"format": {
+			// format(fmt, args...) formats the arguments according to the Go
+			// fmt package verbs, e.g.: `format('%s <%s>', @name, @email)`.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				f, err := stringArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				vals := make([]any, 0, len(args)-1)
+				for _, arg := range args[1:] {
+					v, err := argValue(ctx, arg)
+					if err != nil {
+						return nil, err
+					}
+					vals = append(vals, v)
+				}
+				return fmt.Sprintf(f, vals...), nil
+			},
+			typ:      TypeString,
+			args:     []Type{TypeString, TypeUnknown},
+			optional: 1,
+			variadic: true,
+		},
+		"matches": {
+			// matches(s, pattern) reports whether the string contains
+			// a match of the RE2 regular expression.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				return regexMatch(ctx, args[0], args[1])
+			},
+			typ:  TypeBool,
+			args: []Type{TypeString, TypeString},
+		},
+		"hex": {
+			// hex(b) returns the lowercase hexadecimal representation of the bytes.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				b, err := bytesArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return hex.EncodeToString(b), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeBytes},
+		},
+		"base64": {
+			// base64(b) returns the standard base64 encoding of the bytes.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				b, err := bytesArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return base64.StdEncoding.EncodeToString(b), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeBytes},
+		},
+		"utf8": {
+			// utf8(b) decodes the UTF-8 encoded bytes to a string. It fails if
+			// the bytes are not a valid UTF-8 sequence.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				b, err := bytesArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				if !utf8.Valid(b) {
+					return nil, fmt.Errorf("%w: %v is not a valid UTF-8 sequence", ErrInvalidType, args[0])
+				}
+				return string(b), nil
+			},
+			typ:  TypeString,
+			args: []Type{TypeBytes},
+		},
+		"bytes-length": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				b, err := bytesArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return int64(len(b)), nil
+			},
+			typ:  TypeInt,
+			args: []Type{TypeBytes},
+		},
+		"has-prefix-bytes": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				b, err := bytesArg(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				prefix, err := bytesArg(ctx, args[1])
+				if err != nil {
+					return nil, err
+				}
+				return bytes.HasPrefix(b, prefix), nil
+			},
+			typ:  TypeBool,
+			args: []Type{TypeBytes, TypeBytes},
+		},
+		"first": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				if _, ok := contextSize(ctx); !ok {
+					return nil, fmt.Errorf("first() expects a list or an indexed context")
+				}
+				return int64(positionBase(ctx)), nil
 			},
 			typ: TypeInt,
 		},
+		"last": {
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				size, ok := contextSize(ctx)
+				if !ok {
+					return nil, fmt.Errorf("last() expects a list or an indexed context")
+				}
+				return int64(size - 1 + positionBase(ctx)), nil
+			},
+			typ: TypeInt,
+		},
+		"count": {
+			// count(ns) returns the number of the node set values.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				vs, err := aggregateValues(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				return int64(len(vs)), nil
+			},
+			typ:  TypeInt,
+			args: []Type{TypeUnknown},
+		},
+		"distinct-count": {
+			// distinct-count(ns) returns the number of the distinct node set values.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				vs, err := aggregateScalars(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				seen := make(map[any]struct{}, len(vs))
+				for _, v := range vs {
+					seen[v] = struct{}{}
+				}
+				return int64(len(seen)), nil
+			},
+			typ:  TypeInt,
+			args: []Type{TypeUnknown},
+		},
+		"sum": {
+			// sum(ns) returns the sum of the numeric node set values. The sum
+			// of an empty node set is 0.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ns, err := aggregateNumbers(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				if len(ns) == 0 {
+					typ, err := aggregateType(ctx, args)
+					if err != nil {
+						return nil, err
+					}
+					return zeroNumber(typ), nil
+				}
+				return sumNumbers(ns)
+			},
+			typeOf: aggregateType,
+			args:   []Type{TypeUnknown},
+		},
+		"avg": {
+			// avg(ns) returns the arithmetic mean of the numeric node set values.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ns, err := aggregateNumbers(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				if len(ns) == 0 {
+					return nil, PropNotSet
+				}
+				sum, err := sumNumbers(ns)
+				if err != nil {
+					return nil, err
+				}
+				f, err := numberToFloat64(sum)
+				if err != nil {
+					return nil, err
+				}
+				return f / float64(len(ns)), nil
+			},
+			typ:  TypeFloat,
+			args: []Type{TypeUnknown},
+		},
+		"min": {
+			// min(ns) returns the smallest numeric node set value.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ns, err := aggregateNumbers(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				if len(ns) == 0 {
+					return nil, PropNotSet
+				}
+				return extremeNumber(ns, -1)
+			},
+			typeOf: aggregateType,
+			args:   []Type{TypeUnknown},
+		},
+		"max": {
+			// max(ns) returns the largest numeric node set value.
+			body: func(ctx EvalContext, args []Expression) (any, error) {
+				ns, err := aggregateNumbers(ctx, args[0])
+				if err != nil {
+					return nil, err
+				}
+				if len(ns) == 0 {
+					return nil, PropNotSet
+				}
+				return extremeNumber(ns, 1)
+			},
+			typeOf: aggregateType,
+			args:   []Type{TypeUnknown},
+		},
 	}
 )
 
+// aggregateValues evaluates the aggregate function argument to a list of
+// values. Node sets and repeated fields contribute all their elements,
+// unset properties contribute nothing.
+func aggregateValues(ctx EvalContext, arg Expression) ([]any, error) {
+	v, err := arg.Eval(ctx.Copy(WithEnforceBool(false)))
+	if err == PropNotSet {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var vs []any
+	switch vv := v.(type) {
+	case NodeSet:
+		vs = make([]any, 0, len(vv))
+		for _, n := range vv {
+			vs = append(vs, n.Interface())
+		}
+	case protoreflect.List:
+		vs = make([]any, 0, vv.Len())
+		for i := 0; i < vv.Len(); i++ {
+			vs = append(vs, vv.Get(i).Interface())
+		}
+	default:
+		vs = []any{v}
+	}
+	return vs, nil
+}
+
+// aggregateScalars is similar to aggregateValues but it requires the values
+// to be scalars. Bytes are represented as strings.
+func aggregateScalars(ctx EvalContext, arg Expression) ([]any, error) {
+	vs, err := aggregateValues(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, 0, len(vs))
+	for _, v := range vs {
+		if b, ok := v.([]byte); ok {
+			res = append(res, string(b))
+			continue
+		}
+		sv, _, ok := scalarValue(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v is not a scalar", ErrInvalidType, v)
+		}
+		res = append(res, sv)
+	}
+	return res, nil
+}
+
+// aggregateNumbers is similar to aggregateScalars but it requires the values
+// to be numeric. float32 values are converted to float64 through their
+// shortest decimal form, e.g.: 30.6 rather than 30.600000381469727.
+func aggregateNumbers(ctx EvalContext, arg Expression) ([]any, error) {
+	vs, err := aggregateValues(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, 0, len(vs))
+	for _, v := range vs {
+		if f, ok := v.(float32); ok {
+			d, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+			res = append(res, d)
+			continue
+		}
+		sv, typ, ok := scalarValue(v)
+		if !ok || !isNumericType(typ) {
+			return nil, fmt.Errorf("%w %T for %v, want a number", ErrInvalidType, v, arg)
+		}
+		res = append(res, sv)
+	}
+	return res, nil
+}
+
+// aggregateType returns the result type of a numeric aggregate: the type of
+// the aggregated property. The type of the node set values is only known in
+// the runtime.
+func aggregateType(ctx EvalContext, args []Expression) (Type, error) {
+	if _, ok := ctx.This().(protoreflect.List); ok {
+		return TypeNodeSet, nil
+	}
+	typ, err := args[0].Type(ctx.Copy(WithEnforceBool(false)))
+	if err != nil {
+		return TypeUnknown, err
+	}
+	if isNumericType(typ) {
+		return typ, nil
+	}
+	return TypeNodeSet, nil
+}
+
+// sumNumbers adds up the numbers following the arithmetic rules (see
+// numericArith): integers are summed up without a precision loss and an
+// overflow is an error.
+func sumNumbers(ns []any) (any, error) {
+	sum := ns[0]
+	for _, n := range ns[1:] {
+		_, styp, _ := scalarValue(sum)
+		_, ntyp, _ := scalarValue(n)
+		next, err := numericArith(OpPlus, sum, styp, n, ntyp)
+		if err != nil {
+			return nil, err
+		}
+		// Unlike the unsigned arithmetic, the sum does not wrap around.
+		if u, ok := next.(uint64); ok {
+			if su, _ := toUint64(sum); u < su {
+				return nil, fmt.Errorf("%w: %v + %v", ErrOverflow, sum, n)
+			}
+		}
+		sum = next
+	}
+	return sum, nil
+}
+
+// zeroNumber returns the zero value of the numeric type. The zero of an
+// unknown type is an integer.
+func zeroNumber(typ Type) any {
+	switch typ {
+	case TypeFloat:
+		return float64(0)
+	case TypeUint:
+		return uint64(0)
+	default:
+		return int64(0)
+	}
+}
+
+// extremeNumber returns the smallest (dir < 0) or the largest (dir > 0)
+// number as is. The result is NaN if any of the numbers is NaN.
+func extremeNumber(ns []any, dir int) (any, error) {
+	res := ns[0]
+	for _, n := range ns[1:] {
+		c, ordered, err := compareNumbers(n, res)
+		if err != nil {
+			return nil, err
+		}
+		if !ordered {
+			return math.NaN(), nil
+		}
+		if c == dir {
+			res = n
+		}
+	}
+	return res, nil
+}
+
+// argValue evaluates the function argument. Unset properties evaluate to
+// the default values and node sets to the value of the first node.
+func argValue(ctx EvalContext, arg Expression) (any, error) {
+	v, err := arg.Eval(ctx.Copy(WithUseDefault(true)))
+	if err != nil {
+		return nil, err
+	}
+	if ns, ok := v.(NodeSet); ok {
+		if len(ns) == 0 {
+			return nil, PropNotSet
+		}
+		v = ns[0].Interface()
+	}
+	if sv, _, ok := scalarValue(v); ok {
+		return sv, nil
+	}
+	return v, nil
+}
+
+func stringArg(ctx EvalContext, arg Expression) (string, error) {
+	v, err := argValue(ctx, arg)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w %T for %v, want string", ErrInvalidType, v, arg)
+	}
+	return s, nil
+}
+
+func bytesArg(ctx EvalContext, arg Expression) ([]byte, error) {
+	v, err := argValue(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for %v, want bytes", ErrInvalidType, v, arg)
+	}
+	return b, nil
+}
+
+func stringArgs(ctx EvalContext, args []Expression) ([]string, error) {
+	res := make([]string, 0, len(args))
+	for _, arg := range args {
+		s, err := stringArg(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func intArg(ctx EvalContext, arg Expression) (int64, error) {
+	v, err := argValue(ctx, arg)
+	if err != nil {
+		return 0, err
+	}
+	return toInt64(v)
+}
+
+// positionBase returns the position of the first list element: 0 by default
+// and 1 for XPath-compatible positions.
+func positionBase(ctx EvalContext) int {
+	if ctx.Options().OneBasedPositions {
+		return 1
+	}
+	return 0
+}
+
+// contextSize returns the size of the context list.
+func contextSize(ctx EvalContext) (int, bool) {
+	if list, ok := ctx.This().(protoreflect.List); ok {
+		return list.Len(), true
+	}
+	if ictx, ok := ctx.(IndexedEvalContext); ok && ictx.Size() > 0 {
+		return ictx.Size(), true
+	}
+	return 0, false
+}
+
 type Expression interface {
 	Eval(EvalContext) (any, error)
 	Type(EvalContext) (Type, error)
@@ -130,12 +844,26 @@ func (l *LiteralExpr) Eval(EvalContext) (any, error) {
 			return nil, err
 		}
 		return intv, nil
+	case TypeUint:
+		uintv, err := toUint64(l.value)
+		if err != nil {
+			return nil, err
+		}
+		return uintv, nil
 	case TypeFloat:
+		// float32 values are kept as is for the float32-aware comparison.
+		if f, ok := l.value.(float32); ok {
+			return f, nil
+		}
 		floatv, err := toFloat64(l.value)
 		if err != nil {
 			return nil, err
 		}
 		return floatv, nil
+	case TypeBytes:
+		return l.value.([]byte), nil
+	case TypeTimestamp, TypeDuration:
+		return timeOperand(l.value, l.typ)
 	default:
 		return nil, fmt.Errorf("Unknown type %v", l.typ)
 	}
@@ -145,117 +873,796 @@ func (l *LiteralExpr) Type(EvalContext) (Type, error) {
 	return l.typ, nil
 }
 
-func (l *LiteralExpr) String() string {
-	return fmt.Sprintf("%v", l.value)
+func (l *LiteralExpr) String() string {
+	if b, ok := l.value.([]byte); ok {
+		return fmt.Sprintf("hex'%x'", b)
+	}
+	return fmt.Sprintf("%v", l.value)
+}
+
+// RegexExpr is a regular expression literal compiled at the query compile
+// time. It evaluates to the pattern string.
+type RegexExpr struct {
+	re *regexp.Regexp
+}
+
+var _ Expression = (*RegexExpr)(nil)
+
+func NewRegexExpr(re *regexp.Regexp) *RegexExpr {
+	return &RegexExpr{
+		re: re,
+	}
+}
+
+func (r *RegexExpr) Eval(EvalContext) (any, error) {
+	return r.re.String(), nil
+}
+
+func (r *RegexExpr) Type(EvalContext) (Type, error) {
+	return TypeString, nil
+}
+
+func (r *RegexExpr) String() string {
+	return r.re.String()
+}
+
+// regexMatch reports whether the subject string contains a match of the
+// pattern. Non-literal patterns are compiled on every evaluation.
+func regexMatch(ctx EvalContext, subject, pattern Expression) (bool, error) {
+	s, err := stringArg(ctx, subject)
+	if err != nil {
+		return false, err
+	}
+	if r, ok := pattern.(*RegexExpr); ok {
+		return r.re.MatchString(s), nil
+	}
+	p, err := stringArg(ctx, pattern)
+	if err != nil {
+		return false, err
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidRegex, err)
+	}
+	return re.MatchString(s), nil
+}
+
+type PropertyExpr struct {
+	name string
+	// path is the list of the nested message fields leading to the property
+	// for the dotted access, e.g.: `@address.city`. It is empty otherwise.
+	path []string
+	// fd is the field descriptor resolved at compile time (see CompileFor).
+	fd protoreflect.FieldDescriptor
+}
+
+var _ Expression = (*PropertyExpr)(nil)
+
+func NewPropertyExpr(name string) *PropertyExpr {
+	return &PropertyExpr{
+		name: name,
+	}
+}
+
+var (
+	PropNotSet = fmt.Errorf("Property not set")
+)
+
+func (p *PropertyExpr) Eval(ctx EvalContext) (any, error) {
+	// TODO(osdrv): implement wildcard
+	msg, ok := ctx.This().(protoreflect.Message)
+	if !ok {
+		return nil, fmt.Errorf("Invalid list value %T, want: protoreflect.Message", ctx.This())
+	}
+	msg, fd, err := p.resolve(msg)
+	if err != nil {
+		return nil, err
+	}
+	if fd == nil {
+		// An unknown field is trivially not set, but we want to keep
+		// the distinction for the strict evaluation mode.
+		return nil, fmt.Errorf("%w: %w: %v", PropNotSet, ErrFieldNotFound, p.name)
+	}
+	if ctx.Options().EnforceBool {
+		return msg.Has(fd), nil
+	}
+	// Enums are special case, we need to return the name of the enum value.
+	if fd.Kind() == protoreflect.EnumKind {
+		ed := fd.Enum()
+		values := ed.Values()
+		ival := msg.Get(fd).Enum()
+		return string(values.Get(int(ival)).Name()), nil
+	}
+	if _, ok := wellKnownFieldType(fd); ok {
+		// The well-known messages are nullable: an unset one has no
+		// default value.
+		if !msg.Has(fd) {
+			return nil, PropNotSet
+		}
+		v, _ := unwrapMessage(msg.Get(fd).Message())
+		return v, nil
+	}
+	var v protoreflect.Value
+	if msg.Has(fd) {
+		v = msg.Get(fd)
+	} else if ctx.Options().UseDefault {
+		v = fd.Default()
+	} else {
+		return nil, PropNotSet
+	}
+	return v.Interface(), nil
+}
+
+func (p *PropertyExpr) Type(ctx EvalContext) (Type, error) {
+	if ctx.Options().EnforceBool {
+		return TypeBool, nil
+	}
+	msg, ok := ctx.This().(protoreflect.Message)
+	if !ok {
+		return TypeUnknown, fmt.Errorf("Invalid proto value %T, want: protoreflect.Message", ctx.This())
+	}
+	_, fd, err := p.resolve(msg)
+	if err != nil {
+		return TypeUnknown, err
+	}
+	if fd == nil {
+		return TypeUnknown, fmt.Errorf("%w: %v", ErrFieldNotFound, p.name)
+	}
+	if typ, ok := wellKnownFieldType(fd); ok {
+		return typ, nil
+	}
+	return kindType(fd.Kind())
+}
+
+// kindType returns the expression type of the protobuf scalar kind.
+func kindType(kind protoreflect.Kind) (Type, error) {
+	switch kind {
+	case protoreflect.BoolKind:
+		return TypeBool, nil
+	case protoreflect.StringKind:
+		return TypeString, nil
+	case protoreflect.BytesKind:
+		return TypeBytes, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return TypeInt, nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return TypeUint, nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return TypeFloat, nil
+	case protoreflect.EnumKind:
+		return TypeEnum, nil
+	}
+	return TypeUnknown, fmt.Errorf("%w: unsupported field type %v", ErrInvalidType, kind)
+}
+
+// resolve descends the dotted path and returns the message holding the
+// property along with the property field descriptor. The descriptor is nil
+// if the message has no such field. Unset nested messages are traversed as
+// empty messages, hence their properties are not set.
+func (p *PropertyExpr) resolve(msg protoreflect.Message) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
+	for _, name := range p.path {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, nil, fmt.Errorf("%w: %w: %v", PropNotSet, ErrFieldNotFound, name)
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return nil, nil, fmt.Errorf("%w: %v is not a singular message field", ErrInvalidType, name)
+		}
+		msg = msg.Get(fd).Message()
+	}
+	return msg, p.field(msg), nil
+}
+
+// field returns the property field descriptor. It takes a shortcut if the
+// descriptor has been resolved at compile time.
+func (p *PropertyExpr) field(msg protoreflect.Message) protoreflect.FieldDescriptor {
+	if p.fd != nil && p.fd.ContainingMessage().FullName() == msg.Descriptor().FullName() {
+		return p.fd
+	}
+	return msg.Descriptor().Fields().ByName(protoreflect.Name(p.name))
+}
+
+func (p *PropertyExpr) String() string {
+	if len(p.path) > 0 {
+		return fmt.Sprintf("@%v.%v", strings.Join(p.path, "."), p.name)
+	}
+	return fmt.Sprintf("@%v", p.name)
+}
+
+// SelfExpr is the `.` operator: it evaluates to the context value itself.
+// It is primarily used to filter repeated scalars, e.g.: `/items/int32s[. > 5]`.
+type SelfExpr struct{}
+
+var _ Expression = (*SelfExpr)(nil)
+
+func NewSelfExpr() *SelfExpr {
+	return &SelfExpr{}
+}
+
+func (s *SelfExpr) Eval(ctx EvalContext) (any, error) {
+	this := ctx.This()
+	if v, ok := this.(protoreflect.Value); ok {
+		this = v.Interface()
+	}
+	if msg, ok := this.(protoreflect.Message); ok {
+		if v, ok := unwrapMessage(msg); ok {
+			this = v
+		}
+	}
+	v, typ, ok := scalarValue(this)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for `.` operator, want a scalar", ErrInvalidType, this)
+	}
+	if ctx.Options().EnforceBool && typ != TypeBool {
+		// A scalar value is always present.
+		return true, nil
+	}
+	if f, ok := this.(float32); ok {
+		// Keep float32 for the float32-aware comparison.
+		return f, nil
+	}
+	return v, nil
+}
+
+func (s *SelfExpr) Type(ctx EvalContext) (Type, error) {
+	if ctx.Options().EnforceBool {
+		return TypeBool, nil
+	}
+	this := ctx.This()
+	switch v := this.(type) {
+	case protoreflect.Value:
+		this = v.Interface()
+	case protoreflect.List:
+		// The type of a list is resolved in the runtime by the element type.
+		this = v.NewElement().Interface()
+	}
+	_, typ, ok := scalarValue(this)
+	if !ok {
+		return TypeUnknown, fmt.Errorf("%w %T for `.` operator, want a scalar", ErrInvalidType, this)
+	}
+	return typ, nil
+}
+
+func (s *SelfExpr) String() string {
+	return "."
+}
+
+// PathExpr is a query evaluated relative to the context value, or to the
+// document root if the path is absolute. It evaluates to a NodeSet, or to a
+// boolean indicating that the node set is not empty under a boolean context
+// enforcement.
+type PathExpr struct {
+	query    Query
+	absolute bool
+}
+
+var _ Expression = (*PathExpr)(nil)
+
+func NewPathExpr(query Query) *PathExpr {
+	return &PathExpr{
+		query: query,
+	}
+}
+
+func NewAbsolutePathExpr(query Query) *PathExpr {
+	return &PathExpr{
+		query:    query,
+		absolute: true,
+	}
+}
+
+func (p *PathExpr) Eval(ctx EvalContext) (any, error) {
+	ns, err := p.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Options().EnforceBool {
+		return len(ns) > 0, nil
+	}
+	return ns, nil
+}
+
+func (p *PathExpr) eval(ctx EvalContext) (NodeSet, error) {
+	scope := ctx.Options().scope
+	switch {
+	case p.absolute && ctx.Root() == nil:
+		return nil, fmt.Errorf("Absolute path %v requires a root message", p)
+	case p.absolute && scope == nil:
+		return collectNodes(context.Background(), p.query, &findOptions{now: ctx.Options().now}, ctx.Root(), rootItem(ctx.Root()))
+	case p.absolute:
+		return scope.ev.absolute(p)
+	case scope == nil:
+		return nil, fmt.Errorf("Path expression %v requires a query evaluation scope", p)
+	default:
+		return scope.ev.subquery(p.query, scope.item)
+	}
+}
+
+func (p *PathExpr) Type(ctx EvalContext) (Type, error) {
+	if ctx.Options().EnforceBool {
+		return TypeBool, nil
+	}
+	return TypeNodeSet, nil
+}
+
+func (p *PathExpr) String() string {
+	return p.query.String()
+}
+
+// SliceExpr is a Python-style slice key, e.g.: `[1:3]`, `[:5]`, `[-2:]` or
+// `[::2]`. The bounds are optional integer expressions. Negative bounds
+// count from the end. Unlike the indices, the bounds are always 0-based.
+type SliceExpr struct {
+	start, stop, step Expression
+}
+
+var _ Expression = (*SliceExpr)(nil)
+
+func NewSliceExpr(start, stop, step Expression) *SliceExpr {
+	return &SliceExpr{
+		start: start,
+		stop:  stop,
+		step:  step,
+	}
+}
+
+// sliceBounds is the evaluated slice.
+type sliceBounds struct {
+	start, stop *int64
+	step        int64
+}
+
+func (s *SliceExpr) Eval(ctx EvalContext) (any, error) {
+	ctx = ctx.Copy(WithEnforceBool(false))
+	sb := sliceBounds{step: 1}
+	for _, b := range []struct {
+		expr Expression
+		ptr  **int64
+	}{{s.start, &sb.start}, {s.stop, &sb.stop}} {
+		if b.expr == nil {
+			continue
+		}
+		v, err := intArg(ctx, b.expr)
+		if err != nil {
+			return nil, err
+		}
+		*b.ptr = &v
+	}
+	if s.step != nil {
+		v, err := intArg(ctx, s.step)
+		if err != nil {
+			return nil, err
+		}
+		if v == 0 {
+			return nil, fmt.Errorf("%w: slice step can not be zero", ErrInvalidArgs)
+		}
+		sb.step = v
+	}
+	return sb, nil
+}
+
+func (s *SliceExpr) Type(ctx EvalContext) (Type, error) {
+	ctx = ctx.Copy(WithEnforceBool(false))
+	for _, b := range []Expression{s.start, s.stop, s.step} {
+		if b == nil {
+			continue
+		}
+		typ, err := b.Type(ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		if !isIntegerType(typ) && typ != TypeNodeSet {
+			return TypeUnknown, fmt.Errorf("%w %v for slice bound %v, want int", ErrInvalidType, TypeToStr[typ], b)
+		}
+	}
+	return TypeSlice, nil
+}
+
+func (s *SliceExpr) String() string {
+	var b strings.Builder
+	for i, bound := range []Expression{s.start, s.stop, s.step} {
+		if i == 2 && bound == nil {
+			break
+		}
+		if i > 0 {
+			b.WriteString(":")
+		}
+		if bound != nil {
+			b.WriteString(bound.String())
+		}
+	}
+	return b.String()
+}
+
+// indices returns the indices of the slice elements in a sequence of length
+// n. It follows the Python slice semantics: the out of range bounds are
+// clipped and a negative step walks the sequence backwards.
+func (sb sliceBounds) indices(n int) []int {
+	clip := func(b *int64, def, lo, hi int) int {
+		if b == nil {
+			return def
+		}
+		v := *b
+		if v < 0 {
+			v += int64(n)
+		}
+		return int(max(int64(lo), min(int64(hi), v)))
+	}
+	// The steps longer than the sequence select the start element only, the
+	// step is clamped so that the index does not overflow.
+	step := int(max(-int64(n)-1, min(int64(n)+1, sb.step)))
+	var res []int
+	if step > 0 {
+		start, stop := clip(sb.start, 0, 0, n), clip(sb.stop, n, 0, n)
+		for i := start; i < stop; i += step {
+			res = append(res, i)
+		}
+	} else {
+		start, stop := clip(sb.start, n-1, -1, n-1), clip(sb.stop, -1, -1, n-1)
+		for i := start; i > stop; i += step {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// formatSlice formats the slice of the given element indices (see indices)
+// with the resolved bounds, e.g.: `[-2:]` of 5 elements is `3:5`.
+func formatSlice(ix []int) string {
+	switch len(ix) {
+	case 0:
+		return "0:0"
+	case 1:
+		return fmt.Sprintf("%d:%d", ix[0], ix[0]+1)
+	}
+	first, last, step := ix[0], ix[len(ix)-1], ix[1]-ix[0]
+	switch {
+	case step == 1:
+		return fmt.Sprintf("%d:%d", first, last+1)
+	case step > 0:
+		return fmt.Sprintf("%d:%d:%d", first, last+1, step)
+	case last == 0:
+		// A negative stop counts from the end, the start is left open.
+		return fmt.Sprintf("%d::%d", first, step)
+	}
+	return fmt.Sprintf("%d:%d:%d", first, last-1, step)
+}
+
+// VariableExpr is a reference to a variable bound to the query evaluation,
+// e.g.: `$name` (see Bind). Its type is the type of the bound value.
+type VariableExpr struct {
+	name string
+}
+
+var _ Expression = (*VariableExpr)(nil)
+
+func NewVariableExpr(name string) *VariableExpr {
+	return &VariableExpr{
+		name: name,
+	}
+}
+
+func (v *VariableExpr) bound(ctx EvalContext) (boundVar, error) {
+	bv, ok := ctx.Options().vars[v.name]
+	if !ok {
+		return boundVar{}, fmt.Errorf("%w: $%v", ErrUnboundVariable, v.name)
+	}
+	return bv, nil
+}
+
+func (v *VariableExpr) Eval(ctx EvalContext) (any, error) {
+	bv, err := v.bound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bv.value, nil
+}
+
+func (v *VariableExpr) Type(ctx EvalContext) (Type, error) {
+	bv, err := v.bound(ctx)
+	if err != nil {
+		return TypeUnknown, err
+	}
+	return bv.typ, nil
+}
+
+func (v *VariableExpr) String() string {
+	return "$" + v.name
+}
+
+// ListExpr is a literal list, e.g.: `(1, 2, 3)`. The list values are hashed at
+// the query compile time for the membership tests (see InExpr).
+type ListExpr struct {
+	elems []Expression
+	typ   Type
+	set   map[any]struct{}
+	// set32 holds the numeric values rounded to float32 for the float32-aware
+	// membership tests.
+	set32 map[float32]struct{}
+}
+
+var _ Expression = (*ListExpr)(nil)
+
+func NewListExpr(elems []Expression) (*ListExpr, error) {
+	l := &ListExpr{
+		elems: elems,
+		typ:   TypeUnknown,
+		set:   make(map[any]struct{}, len(elems)),
+		set32: make(map[float32]struct{}),
+	}
+	for _, elem := range elems {
+		v, typ, ok := constValue(elem)
+		if !ok {
+			return nil, fmt.Errorf("%w: list element %v is not a literal", ErrInvalidType, elem)
+		}
+		switch {
+		case l.typ == TypeUnknown || l.typ == typ:
+			l.typ = typ
+		case isNumericType(l.typ) && isNumericType(typ):
+			if typ == TypeFloat {
+				l.typ = TypeFloat
+			}
+		default:
+			return nil, fmt.Errorf("%w(%v Vs %v) in list %v", ErrTypeMismatch, TypeToStr[l.typ], TypeToStr[typ], elem)
+		}
+		l.set[setKey(v)] = struct{}{}
+		if f, err := numberToFloat64(v); err == nil {
+			l.set32[float32(f)] = struct{}{}
+		}
+	}
+	return l, nil
+}
+
+// bytesKey is the hash key of a bytes value. It keeps bytes distinct from
+// strings.
+type bytesKey string
+
+// setKey normalizes the scalar value for the hash lookup: integral numbers
+// are keyed by their integer value regardless of the type.
+func setKey(v any) any {
+	switch n := v.(type) {
+	case []byte:
+		return bytesKey(n)
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n)
+		}
+	case float64:
+		if t := math.Trunc(n); t == n && t >= math.MinInt64 && t < math.MaxInt64 {
+			return int64(t)
+		} else if t == n && t >= 0 && t < math.MaxUint64 {
+			return uint64(t)
+		}
+	}
+	return v
+}
+
+// constValue returns the value of a literal or a signed numeric literal.
+func constValue(e Expression) (any, Type, bool) {
+	switch ex := e.(type) {
+	case *LiteralExpr:
+		v, err := ex.Eval(nil)
+		return v, ex.typ, err == nil
+	case *UnaryExpr:
+		lit, ok := ex.expr.(*LiteralExpr)
+		if !ok || (ex.op != OpMinus && ex.op != OpPlus) {
+			return nil, TypeUnknown, false
+		}
+		v, err := ex.Eval(NewEvalContext(nil))
+		if err != nil {
+			return nil, TypeUnknown, false
+		}
+		return v, lit.typ, true
+	}
+	return nil, TypeUnknown, false
+}
+
+// Eval returns the list values as a node set.
+func (l *ListExpr) Eval(EvalContext) (any, error) {
+	res := make(NodeSet, 0, len(l.elems))
+	for _, elem := range l.elems {
+		v, _, _ := constValue(elem)
+		res = append(res, valueNode(protoreflect.ValueOf(v)))
+	}
+	return res, nil
+}
+
+func (l *ListExpr) Type(EvalContext) (Type, error) {
+	return TypeNodeSet, nil
+}
+
+func (l *ListExpr) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i, elem := range l.elems {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(elem.String())
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// contains reports whether the list contains the value. Numbers are compared
+// by value regardless of the type, float32 values are compared with float32
+// precision.
+func (l *ListExpr) contains(v any) bool {
+	if f, ok := v.(float32); ok {
+		_, ok := l.set32[f]
+		return ok
+	}
+	_, ok := l.set[setKey(v)]
+	return ok
 }
 
-type PropertyExpr struct {
-	name string
+// InExpr is a set membership test, e.g.: `@type in ('PHONE_TYPE_WORK', 'PHONE_TYPE_HOME')`
+// or `@id not in (1, 2, 3)`. A node set subject is a member if any of its
+// values is. The set is either a literal list or an expression evaluating to
+// a node set, e.g.: `@name in $names`.
+type InExpr struct {
+	expr, list Expression
+	negate     bool
 }
 
-var _ Expression = (*PropertyExpr)(nil)
+var _ Expression = (*InExpr)(nil)
 
-func NewPropertyExpr(name string) *PropertyExpr {
-	return &PropertyExpr{
-		name: name,
+func NewInExpr(expr, list Expression, negate bool) *InExpr {
+	return &InExpr{
+		expr:   expr,
+		list:   list,
+		negate: negate,
 	}
 }
 
-var (
-	PropNotSet = fmt.Errorf("Property not set")
-)
-
-func (p *PropertyExpr) Eval(ctx EvalContext) (any, error) {
-	// TODO(osdrv): implement wildcard
-	msg, ok := ctx.This().(protoreflect.Message)
-	if !ok {
-		return nil, fmt.Errorf("Invalid list value %T, want: protoreflect.Message", ctx.This())
+func (in *InExpr) Eval(ctx EvalContext) (any, error) {
+	ctx = ctx.Copy(WithEnforceBool(false), WithUseDefault(true))
+	list, err := in.set(ctx)
+	if err != nil {
+		return nil, err
 	}
-	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(p.name))
-	if fd != nil {
-		if ctx.Options().EnforceBool {
-			return msg.Has(fd), nil
-		}
-		// Enums are special case, we need to return the name of the enum value.
-		if fd.Kind() == protoreflect.EnumKind {
-			ed := fd.Enum()
-			values := ed.Values()
-			ival := msg.Get(fd).Enum()
-			return string(values.Get(int(ival)).Name()), nil
+	typ, err := in.expr.Type(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list.typ != TypeUnknown && !typesCompatible(typ, list.typ) {
+		return nil, fmt.Errorf("%w(%v Vs %v)", ErrTypeMismatch, TypeToStr[typ], TypeToStr[list.typ])
+	}
+	vs, err := aggregateValues(ctx, in.expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vs {
+		if sv, _, ok := scalarValue(v); ok && !isFloat32(v) {
+			v = sv
 		}
-		if msg.Has(fd) {
-			return msg.Get(fd).Interface(), nil
-		} else if ctx.Options().UseDefault {
-			return fd.Default().Interface(), nil
+		if list.contains(v) {
+			return !in.negate, nil
 		}
 	}
-	return nil, PropNotSet
+	return in.negate, nil
 }
 
-func (p *PropertyExpr) Type(ctx EvalContext) (Type, error) {
-	if ctx.Options().EnforceBool {
-		return TypeBool, nil
+// set returns the literal list or the list of the values the set
+// expression evaluates to. The set of a variable or an absolute path does
+// not depend on the context value, hence it is built once per evaluation.
+func (in *InExpr) set(ctx EvalContext) (*ListExpr, error) {
+	if list, ok := in.list.(*ListExpr); ok {
+		return list, nil
 	}
-	// TODO(osdrv): in the future we might pass primitive types directly
-	// to support `.` (this) operator.
-	msg, ok := ctx.This().(protoreflect.Message)
-	if !ok {
-		return TypeUnknown, fmt.Errorf("Invalid proto value %T, want: protoreflect.Message", ctx.This())
+	scope := ctx.Options().scope
+	cached := scope != nil && in.constSet()
+	if cached {
+		if list, ok := scope.ev.sets[in]; ok {
+			return list, nil
+		}
 	}
-	fd, ok := findFieldByName(msg.Interface(), p.name)
-	if !ok {
-		return TypeUnknown, fmt.Errorf("Field %v not found", p.name)
+	vs, err := aggregateScalars(ctx, in.list)
+	if err != nil {
+		return nil, err
 	}
-	switch fd.Kind() {
-	case protoreflect.BoolKind:
-		return TypeBool, nil
-	case protoreflect.StringKind:
-		return TypeString, nil
-	case protoreflect.Int32Kind, protoreflect.Int64Kind,
-		protoreflect.Uint32Kind, protoreflect.Uint64Kind:
-		return TypeInt, nil
-	case protoreflect.FloatKind, protoreflect.DoubleKind:
-		return TypeFloat, nil
-	case protoreflect.EnumKind:
-		return TypeEnum, nil
+	elems := make([]Expression, 0, len(vs))
+	for _, v := range vs {
+		sv, typ, _ := scalarValue(v)
+		elems = append(elems, NewLiteralExpr(sv, typ))
 	}
-	return TypeUnknown, fmt.Errorf("Unknown field type %v", fd.Kind())
+	list, err := NewListExpr(elems)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		if scope.ev.sets == nil {
+			scope.ev.sets = make(map[*InExpr]*ListExpr)
+		}
+		scope.ev.sets[in] = list
+	}
+	return list, nil
 }
 
-func (p *PropertyExpr) String() string {
-	return fmt.Sprintf("@%v", p.name)
+// constSet returns true if the set does not depend on the context value.
+func (in *InExpr) constSet() bool {
+	switch ex := in.list.(type) {
+	case *VariableExpr:
+		return true
+	case *PathExpr:
+		return ex.absolute
+	}
+	return false
+}
+
+func (in *InExpr) Type(EvalContext) (Type, error) {
+	return TypeBool, nil
+}
+
+func (in *InExpr) String() string {
+	if in.negate {
+		return fmt.Sprintf("%v not in %v", in.expr, in.list)
+	}
+	return fmt.Sprintf("%v in %v", in.expr, in.list)
 }
 
 type FunctionCallExpr struct {
 	handle string
 	args   []Expression
 	typ    Type
+	// fn is the function implementation resolved at compile time.
+	fn *Builtin
 }
 
 var _ Expression = (*FunctionCallExpr)(nil)
 
 func NewFunctionCallExpr(handle string, args []Expression) (*FunctionCallExpr, error) {
-	builtin, ok := builtins[handle]
-	if !ok {
-		return nil, fmt.Errorf("Unknown function invocation: %v", handle)
-	}
-	return &FunctionCallExpr{
+	f := &FunctionCallExpr{
 		handle: handle,
 		args:   args,
-		typ:    builtin.typ,
-	}, nil
+	}
+	fn, err := f.function()
+	if err != nil {
+		return nil, err
+	}
+	f.fn, f.typ = fn, fn.typ
+	return f, nil
 }
 
-func (f *FunctionCallExpr) Eval(ctx EvalContext) (any, error) {
-	builtin, ok := builtins[f.handle]
+// function returns the resolved function implementation. The calls which
+// are not resolved at compile time are resolved against the built-in and
+// the globally registered functions.
+func (f *FunctionCallExpr) function() (*Builtin, error) {
+	if f.fn != nil {
+		return f.fn, nil
+	}
+	fn, ok := lookupFunction(f.handle, nil)
 	if !ok {
-		return nil, fmt.Errorf("Unknown function %v", f.handle)
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFunction, f.handle)
+	}
+	return fn, nil
+}
+
+func (f *FunctionCallExpr) Eval(ctx EvalContext) (any, error) {
+	fn, err := f.function()
+	if err != nil {
+		return nil, err
+	}
+	if err := fn.checkArgs(ctx, f.handle, f.args); err != nil {
+		return nil, err
 	}
-	return builtin.Call(ctx, f.args)
+	return fn.Call(ctx, f.args)
 }
 
-func (f *FunctionCallExpr) Type(EvalContext) (Type, error) {
-	return builtins[f.handle].typ, nil
+func (f *FunctionCallExpr) Type(ctx EvalContext) (Type, error) {
+	fn, err := f.function()
+	if err != nil {
+		return TypeUnknown, err
+	}
+	if err := fn.checkArgs(ctx, f.handle, f.args); err != nil {
+		return TypeUnknown, err
+	}
+	if fn.typeOf != nil {
+		return fn.typeOf(ctx, f.args)
+	}
+	return fn.typ, nil
 }
 
 func (f *FunctionCallExpr) String() string {
@@ -287,50 +1694,87 @@ func NewUnaryExpr(op Operator, expr Expression) (*UnaryExpr, error) {
 }
 
 func (u *UnaryExpr) Eval(ctx EvalContext) (any, error) {
+	typ, err := u.expr.Type(ctx)
+	if err != nil {
+		return nil, err
+	}
 	switch u.op {
 	case OpMinus, OpPlus:
-		var f int64 = 1
-		if u.op == OpMinus {
-			f = -1
-		}
-		typ, err := u.expr.Type(ctx)
-		if err != nil {
-			return nil, err
-		}
-		if typ != TypeInt {
-			return nil, fmt.Errorf("Invalid type %v for - operator", typ)
+		if !isNumericType(typ) && typ != TypeNodeSet {
+			return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, TypeToStr[typ], OpToStr[u.op])
 		}
 		v, err := u.expr.Eval(ctx)
 		if err != nil {
 			return nil, err
 		}
-		intv, err := toInt64(v)
-		if err != nil {
-			return nil, err
+		if ns, ok := v.(NodeSet); ok {
+			if len(ns) == 0 {
+				return nil, PropNotSet
+			}
+			v = ns[0].Interface()
 		}
-		return f * intv, nil
-	case OpNot:
-		typ, err := u.expr.Type(ctx)
-		if err != nil {
-			return nil, err
+		if u.op == OpPlus {
+			if _, err := numberToFloat64(v); err != nil {
+				return nil, fmt.Errorf("%w %T for + operator", ErrInvalidType, v)
+			}
+			return v, nil
 		}
-		if typ != TypeBool {
-			return nil, fmt.Errorf("Invalid type %v for ! operator", typ)
+		return negate(v)
+	case OpNot:
+		// A node set is truthy if it is not empty, hence its negation
+		// checks the node set is empty, e.g.: `!phones`.
+		if typ != TypeBool && typ != TypeNodeSet {
+			return nil, fmt.Errorf("%w %v for ! operator", ErrInvalidType, TypeToStr[typ])
 		}
 		v, err := u.expr.Eval(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return !v.(bool), nil
+		b, err := toBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidType, err)
+		}
+		return !b, nil
 	default:
 		return nil, fmt.Errorf("Invalid operator %v", u.op)
 	}
 }
 
+// negate returns the negated number. Negating an unsigned integer yields
+// a signed one.
+func negate(v any) (any, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Float32:
+		// Keep float32 for the float32-aware comparison.
+		return -float32(rv.Float()), nil
+	case isFloatKind(rv):
+		return -rv.Float(), nil
+	case isIntKind(rv):
+		if rv.Int() == math.MinInt64 {
+			return nil, fmt.Errorf("%w: -(%d)", ErrOverflow, rv.Int())
+		}
+		return -rv.Int(), nil
+	case isUintKind(rv):
+		if rv.Uint() > 1<<63 {
+			return nil, fmt.Errorf("%w: -(%d)", ErrOverflow, rv.Uint())
+		}
+		return -int64(rv.Uint()), nil
+	}
+	return nil, fmt.Errorf("%w %T for - operator", ErrInvalidType, v)
+}
+
 func (u *UnaryExpr) Type(ctx EvalContext) (Type, error) {
 	switch u.op {
 	case OpMinus, OpPlus:
-		return TypeInt, nil
+		typ, err := u.expr.Type(ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		if typ == TypeUint && u.op == OpMinus {
+			return TypeInt, nil
+		}
+		return typ, nil
 	case OpNot:
 		return TypeBool, nil
 	default:
@@ -365,12 +1809,20 @@ func typesCompatible(a, b Type) bool {
 	if a > b {
 		a, b = b, a
 	}
-	if a == TypeInt && b == TypeFloat {
+	if isNumericType(a) && isNumericType(b) {
 		return true
 	}
 	if a == TypeString && b == TypeEnum {
 		return true
 	}
+	// Time values are compared to the string literals and shifted by durations.
+	if isTimeType(b) && (a == TypeString || isTimeType(a)) {
+		return true
+	}
+	// Node sets are compared element-wise.
+	if a == TypeNodeSet || b == TypeNodeSet {
+		return true
+	}
 
 	return false
 }
@@ -390,12 +1842,21 @@ func (b *BinaryExpr) Eval(ctx EvalContext) (any, error) {
 		return nil, rerr
 	}
 	if !typesCompatible(ltyp, rtyp) {
-		return nil, fmt.Errorf("Type mismatch(%v Vs %v)", TypeToStr[ltyp], TypeToStr[rtyp])
+		return nil, fmt.Errorf("%w(%v Vs %v)", ErrTypeMismatch, TypeToStr[ltyp], TypeToStr[rtyp])
+	}
+	if ltyp == TypeNodeSet || rtyp == TypeNodeSet {
+		return nodeSetBinEval(ctx, b.left, b.right, b.op)
+	}
+	if isTimeType(ltyp) || isTimeType(rtyp) {
+		if b.op == OpEq || b.op == OpNe {
+			ctx = ctx.Copy(WithUseDefault(true))
+		}
+		return timeBinEval(ctx, b.left, b.right, b.op)
 	}
 	switch b.op {
 	case OpEq, OpNe:
 		switch ltyp {
-		case TypeInt, TypeFloat:
+		case TypeInt, TypeUint, TypeFloat:
 			return numericBinEval(ctx.Copy(WithUseDefault(true)), b.left, b.right, b.op)
 		case TypeString:
 			return stringBinEval(ctx.Copy(WithUseDefault(true)), b.left, b.right, b.op)
@@ -403,22 +1864,31 @@ func (b *BinaryExpr) Eval(ctx EvalContext) (any, error) {
 			return boolBinEval(ctx.Copy(WithUseDefault(true)), b.left, b.right, b.op)
 		case TypeEnum:
 			return enumBinEval(ctx.Copy(WithUseDefault(true)), b.left, b.right, b.op)
+		case TypeBytes:
+			return bytesBinEval(ctx.Copy(WithUseDefault(true)), b.left, b.right, b.op)
 		default:
-			return nil, fmt.Errorf("Invalid type `%v` for `=` operator", TypeToStr[ltyp])
+			return nil, fmt.Errorf("%w `%v` for `=` operator", ErrInvalidType, TypeToStr[ltyp])
 		}
 	case OpPlus, OpLt, OpLe, OpGt, OpGe:
 		switch ltyp {
-		case TypeInt, TypeFloat:
+		case TypeInt, TypeUint, TypeFloat:
 			return numericBinEval(ctx, b.left, b.right, b.op)
 		case TypeString:
 			return stringBinEval(ctx, b.left, b.right, b.op)
+		case TypeBytes:
+			return bytesBinEval(ctx, b.left, b.right, b.op)
 		default:
-			return nil, fmt.Errorf("Invalid type %v for %v operator", ltyp, b.op)
+			return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, ltyp, b.op)
 		}
-	case OpMinus, OpDiv, OpMul:
+	case OpMinus, OpDiv, OpMul, OpMod:
 		return numericBinEval(ctx, b.left, b.right, b.op)
 	case OpAnd, OpOr:
 		return boolBinEval(ctx, b.left, b.right, b.op)
+	case OpMatch:
+		if ltyp != TypeString {
+			return nil, fmt.Errorf("%w `%v` for `=~` operator", ErrInvalidType, TypeToStr[ltyp])
+		}
+		return regexMatch(ctx, b.left, b.right)
 	default:
 		return nil, fmt.Errorf("Invalid operator %v", b.op)
 	}
@@ -426,11 +1896,34 @@ func (b *BinaryExpr) Eval(ctx EvalContext) (any, error) {
 
 func (b *BinaryExpr) Type(ctx EvalContext) (Type, error) {
 	switch b.op {
-	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpAnd, OpOr:
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpAnd, OpOr, OpMatch:
 		return TypeBool, nil
 	default:
-
-		return b.left.Type(ctx)
+		ltyp, err := b.left.Type(ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		rtyp, err := b.right.Type(ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		if isTimeType(ltyp) || isTimeType(rtyp) {
+			// The static type of an operation over node sets is not known upfront.
+			if ltyp == TypeNodeSet || rtyp == TypeNodeSet {
+				return TypeNodeSet, nil
+			}
+			return timeArithType(ltyp, rtyp, b.op)
+		}
+		// Any float operand makes the arithmetic float.
+		if isNumericType(ltyp) && rtyp == TypeFloat {
+			return TypeFloat, nil
+		}
+		// Mixed signed and unsigned integers make the arithmetic signed unless
+		// the operands are beyond the int64 range (see numericArith).
+		if ltyp == TypeUint && rtyp == TypeInt {
+			return TypeInt, nil
+		}
+		return ltyp, nil
 	}
 }
 
@@ -443,7 +1936,80 @@ func (b *BinaryExpr) computesBool() bool {
 	// are expected to be boolean. Unlike the ones listed below that would
 	// take any type of operands and output a boolean result.
 	return b.op == OpEq || b.op == OpNe || b.op == OpLt ||
-		b.op == OpLe || b.op == OpGt || b.op == OpGe
+		b.op == OpLe || b.op == OpGt || b.op == OpGe || b.op == OpMatch
+}
+
+// nodeSetBinEval evaluates a binary expression with at least one node set operand.
+// Comparisons follow the existential semantics: the expression is true if
+// it holds for any node of the set. Other operators take the first node value.
+func nodeSetBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
+	as, err := nodeSetOperands(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := nodeSetOperands(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	expr := &BinaryExpr{op: op}
+	if !expr.computesBool() {
+		if len(as) == 0 || len(bs) == 0 {
+			return nil, PropNotSet
+		}
+		expr.left, expr.right = as[0], bs[0]
+		return expr.Eval(ctx)
+	}
+	for _, al := range as {
+		for _, bl := range bs {
+			expr.left, expr.right = al, bl
+			v, err := expr.Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if pick, ok := v.(bool); ok && pick {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// nodeSetOperands returns the node set values as literal expressions if the expression
+// evaluates to a node set. Otherwise it returns the expression itself.
+func nodeSetOperands(ctx EvalContext, e Expression) ([]Expression, error) {
+	typ, err := e.Type(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TypeNodeSet {
+		return []Expression{e}, nil
+	}
+	v, err := e.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ns, ok := v.(NodeSet)
+	if !ok {
+		// Arithmetic over node sets evaluates to a scalar.
+		sv, styp, ok := scalarValue(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v is not a scalar", ErrInvalidType, v)
+		}
+		return []Expression{NewLiteralExpr(sv, styp)}, nil
+	}
+	res := make([]Expression, 0, len(ns))
+	for _, n := range ns {
+		sv, styp, ok := scalarValue(n.Interface())
+		if !ok {
+			return nil, fmt.Errorf("%w: node %v is not a scalar", ErrInvalidType, n)
+		}
+		if isFloat32(n.Interface()) {
+			// Keep float32 for the float32-aware comparison.
+			sv = n.Interface()
+		}
+		res = append(res, NewLiteralExpr(sv, styp))
+	}
+	return res, nil
 }
 
 func numericBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
@@ -451,15 +2017,15 @@ func numericBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error)
 	if aerr != nil {
 		return nil, aerr
 	}
-	if atyp != TypeInt && atyp != TypeFloat {
-		return nil, fmt.Errorf("Invalid type %v for %v operator", atyp, op)
+	if !isNumericType(atyp) {
+		return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, atyp, op)
 	}
 	btyp, berr := b.Type(ctx)
 	if berr != nil {
 		return nil, berr
 	}
-	if btyp != TypeInt && btyp != TypeFloat {
-		return nil, fmt.Errorf("Invalid type %v for %v operator", btyp, op)
+	if !isNumericType(btyp) {
+		return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, btyp, op)
 	}
 	av, err := a.Eval(ctx)
 	if err != nil {
@@ -469,85 +2035,242 @@ func numericBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error)
 	if err != nil {
 		return nil, err
 	}
-	// Coallesce types to float64 if they are both numeric but do not match.
-	if atyp != btyp {
-		if atyp == TypeInt {
-			av = float64(av.(int64))
-			atyp = TypeFloat
-		}
-		if btyp == TypeInt {
-			bv = float64(bv.(int64))
-			btyp = TypeFloat
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		c, ordered, err := compareNumbers(av, bv)
+		if err != nil {
+			return nil, err
 		}
+		return compareResult(op, c, ordered), nil
 	}
-	if atyp == TypeInt {
-		ai, aerr := toInt64(av)
+	return numericArith(op, av, atyp, bv, btyp)
+}
+
+// numericArith computes the arithmetic operation over the numbers of the
+// given types. Any float operand makes the arithmetic float, mixed signed and
+// unsigned integers are computed as int64 if both fit, otherwise an unsigned
+// integer combined with a non-negative signed one is computed as uint64.
+func numericArith(op Operator, av any, atyp Type, bv any, btyp Type) (any, error) {
+	switch {
+	// Coallesce types to float64 if they are both numeric but do not match.
+	case atyp == TypeFloat || btyp == TypeFloat:
+		af, aerr := numberToFloat64(av)
 		if aerr != nil {
 			return nil, aerr
 		}
-		bi, berr := toInt64(bv)
+		bf, berr := numberToFloat64(bv)
 		if berr != nil {
 			return nil, berr
 		}
-		switch op {
-		case OpPlus:
-			return ai + bi, nil
-		case OpMinus:
-			return ai - bi, nil
-		case OpMul:
-			return ai * bi, nil
-		case OpDiv:
-			return ai / bi, nil
-		case OpEq:
-			return ai == bi, nil
-		case OpNe:
-			return ai != bi, nil
-		case OpLt:
-			return ai < bi, nil
-		case OpLe:
-			return ai <= bi, nil
-		case OpGt:
-			return ai > bi, nil
-		case OpGe:
-			return ai >= bi, nil
-		default:
-			return nil, fmt.Errorf("Invalid operator %v", op)
-		}
-	} else if atyp == TypeFloat {
-		af, aerr := toFloat64(av)
+		return floatArith(op, af, bf)
+	case atyp == TypeUint && btyp == TypeUint:
+		au, aerr := toUint64(av)
 		if aerr != nil {
 			return nil, aerr
 		}
-		bf, berr := toFloat64(bv)
+		bu, berr := toUint64(bv)
 		if berr != nil {
 			return nil, berr
 		}
-		switch op {
-		case OpPlus:
-			return af + bf, nil
-		case OpMinus:
-			return af - bf, nil
-		case OpMul:
-			return af * bf, nil
-		case OpDiv:
-			return af / bf, nil
-		case OpEq:
-			return af == bf, nil
-		case OpNe:
-			return af != bf, nil
-		case OpLt:
-			return af < bf, nil
-		case OpLe:
-			return af <= bf, nil
-		case OpGt:
-			return af > bf, nil
-		case OpGe:
-			return af >= bf, nil
-		default:
-			return nil, fmt.Errorf("Invalid operator %v", op)
+		return uintArith(op, au, bu)
+	default:
+		ai, aerr := toInt64(av)
+		bi, berr := toInt64(bv)
+		if aerr == nil && berr == nil {
+			return intArith(op, ai, bi)
+		}
+		au, auerr := toUint64(av)
+		bu, buerr := toUint64(bv)
+		if auerr != nil || buerr != nil {
+			return nil, cmp.Or(aerr, berr)
+		}
+		return uintArith(op, au, bu)
+	}
+}
+
+// intArith computes the integer arithmetic operation. Unlike the Go
+// arithmetic, an overflow is an error rather than a wrap-around. The
+// division truncates towards zero and the remainder has the sign of the
+// dividend.
+func intArith(op Operator, a, b int64) (int64, error) {
+	overflow := func() (int64, error) {
+		return 0, fmt.Errorf("%w: %d %v %d", ErrOverflow, a, OpToStr[op], b)
+	}
+	switch op {
+	case OpPlus:
+		if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+			return overflow()
+		}
+		return a + b, nil
+	case OpMinus:
+		if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+			return overflow()
+		}
+		return a - b, nil
+	case OpMul:
+		if a == 0 || b == 0 {
+			return 0, nil
+		}
+		r := a * b
+		if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return overflow()
+		}
+		return r, nil
+	case OpDiv, OpMod:
+		if b == 0 {
+			return 0, fmt.Errorf("%w: %d %v %d", ErrDivisionByZero, a, OpToStr[op], b)
+		}
+		if op == OpMod {
+			return a % b, nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return overflow()
+		}
+		return a / b, nil
+	}
+	return 0, fmt.Errorf("Invalid operator %v", op)
+}
+
+// uintArith computes the unsigned integer arithmetic operation. Like the Go
+// arithmetic, the unsigned arithmetic is modular: the results wrap around.
+// The division by zero is an error.
+func uintArith(op Operator, a, b uint64) (uint64, error) {
+	switch op {
+	case OpPlus:
+		return a + b, nil
+	case OpMinus:
+		return a - b, nil
+	case OpMul:
+		return a * b, nil
+	case OpDiv, OpMod:
+		if b == 0 {
+			return 0, fmt.Errorf("%w: %d %v %d", ErrDivisionByZero, a, OpToStr[op], b)
+		}
+		if op == OpMod {
+			return a % b, nil
 		}
+		return a / b, nil
 	}
-	panic("should not happen")
+	return 0, fmt.Errorf("Invalid operator %v", op)
+}
+
+// floatArith computes the float arithmetic operation. A division by zero is
+// an error, as it is for integers.
+func floatArith(op Operator, a, b float64) (float64, error) {
+	switch op {
+	case OpPlus:
+		return a + b, nil
+	case OpMinus:
+		return a - b, nil
+	case OpMul:
+		return a * b, nil
+	case OpDiv, OpMod:
+		if b == 0 {
+			return 0, fmt.Errorf("%w: %v %v %v", ErrDivisionByZero, a, OpToStr[op], b)
+		}
+		if op == OpMod {
+			return math.Mod(a, b), nil
+		}
+		return a / b, nil
+	}
+	return 0, fmt.Errorf("Invalid operator %v", op)
+}
+
+// numberToFloat64 converts a numeric value of any kind to float64.
+func numberToFloat64(v any) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case isIntKind(rv):
+		return float64(rv.Int()), nil
+	case isUintKind(rv):
+		return float64(rv.Uint()), nil
+	case isFloatKind(rv):
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// compareNumbers compares two numeric values of any kind without a precision
+// loss: 64-bit integers are never converted to floats. If one of the values
+// is a float32, the other float is rounded to float32 before the comparison,
+// so that `@price = 0.1` holds for a float field set to 0.1. The comparison
+// is unordered if any of the values is NaN.
+func compareNumbers(a, b any) (c int, ordered bool, err error) {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isFloatKind(ra) && isFloatKind(rb):
+		af, bf := ra.Float(), rb.Float()
+		if ra.Kind() == reflect.Float32 || rb.Kind() == reflect.Float32 {
+			af, bf = float64(float32(af)), float64(float32(bf))
+		}
+		if math.IsNaN(af) || math.IsNaN(bf) {
+			return 0, false, nil
+		}
+		return cmp.Compare(af, bf), true, nil
+	case isFloatKind(ra):
+		c, ordered, err := compareNumbers(b, a)
+		return -c, ordered, err
+	case isFloatKind(rb):
+		f := rb.Float()
+		if math.IsNaN(f) {
+			return 0, false, nil
+		}
+		t := math.Trunc(f)
+		// The fractional part breaks the tie between equal integer parts.
+		frac := -cmp.Compare(f, t)
+		switch {
+		case isIntKind(ra):
+			if t < math.MinInt64 {
+				return 1, true, nil
+			} else if t >= math.MaxInt64 {
+				return -1, true, nil
+			}
+			return cmp.Or(cmp.Compare(ra.Int(), int64(t)), frac), true, nil
+		case isUintKind(ra):
+			if t < 0 {
+				return 1, true, nil
+			} else if t >= math.MaxUint64 {
+				return -1, true, nil
+			}
+			return cmp.Or(cmp.Compare(ra.Uint(), uint64(t)), frac), true, nil
+		}
+	case isIntKind(ra) && isIntKind(rb):
+		return cmp.Compare(ra.Int(), rb.Int()), true, nil
+	case isUintKind(ra) && isUintKind(rb):
+		return cmp.Compare(ra.Uint(), rb.Uint()), true, nil
+	case isIntKind(ra) && isUintKind(rb):
+		if ra.Int() < 0 {
+			return -1, true, nil
+		}
+		return cmp.Compare(uint64(ra.Int()), rb.Uint()), true, nil
+	case isUintKind(ra) && isIntKind(rb):
+		c, ordered, err := compareNumbers(b, a)
+		return -c, ordered, err
+	}
+	return 0, false, fmt.Errorf("%w: can not compare %T and %T", ErrInvalidType, a, b)
+}
+
+// compareResult returns the result of the comparison operator given the
+// comparison outcome. Unordered values are only different.
+func compareResult(op Operator, c int, ordered bool) bool {
+	if !ordered {
+		return op == OpNe
+	}
+	switch op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGe:
+		return c >= 0
+	}
+	return false
 }
 
 func stringBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
@@ -556,31 +2279,39 @@ func stringBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
 		return nil, aerr
 	}
 	if atyp != TypeString {
-		return nil, fmt.Errorf("Invalid type %v for %v operator", atyp, op)
+		return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, atyp, op)
 	}
-	av, err := a.Eval(ctx)
+	v, err := a.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
-	bv, err := b.Eval(ctx)
+	av, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for %v operator, want string", ErrInvalidType, v, OpToStr[op])
+	}
+	v, err = b.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
+	bv, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for %v operator, want string", ErrInvalidType, v, OpToStr[op])
+	}
 	switch op {
 	case OpPlus:
-		return av.(string) + bv.(string), nil
+		return av + bv, nil
 	case OpEq:
-		return av.(string) == bv.(string), nil
+		return av == bv, nil
 	case OpNe:
-		return av.(string) != bv.(string), nil
+		return av != bv, nil
 	case OpLt:
-		return av.(string) < bv.(string), nil
+		return av < bv, nil
 	case OpLe:
-		return av.(string) <= bv.(string), nil
+		return av <= bv, nil
 	case OpGt:
-		return av.(string) > bv.(string), nil
+		return av > bv, nil
 	case OpGe:
-		return av.(string) >= bv.(string), nil
+		return av >= bv, nil
 	default:
 		return nil, fmt.Errorf("Invalid operator %v", op)
 	}
@@ -592,38 +2323,73 @@ func boolBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
 		return nil, aerr
 	}
 	if atyp != TypeBool {
-		return nil, fmt.Errorf("Invalid type %v for %v operator", atyp, op)
+		return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, atyp, op)
 	}
-	av, err := a.Eval(ctx)
+	v, err := a.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
+	av, err := toBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidType, err)
+	}
 
 	// There are cases where evaluation of the right side can be avoided.
-	if op == OpAnd && !av.(bool) {
+	if op == OpAnd && !av {
 		return false, nil
-	} else if op == OpOr && av.(bool) {
+	} else if op == OpOr && av {
 		return true, nil
 	}
 
-	bv, err := b.Eval(ctx)
+	v, err = b.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
+	bv, err := toBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidType, err)
+	}
 	switch op {
 	case OpAnd:
-		return av.(bool) && bv.(bool), nil
+		return av && bv, nil
 	case OpOr:
-		return av.(bool) || bv.(bool), nil
+		return av || bv, nil
 	case OpEq:
-		return av.(bool) == bv.(bool), nil
+		return av == bv, nil
 	case OpNe:
-		return av.(bool) != bv.(bool), nil
+		return av != bv, nil
 	default:
 		return nil, fmt.Errorf("Invalid operator %v", op)
 	}
 }
 
+// bytesBinEval compares bytes lexicographically. Bytes are never compared to
+// strings implicitly, use utf8() to decode them.
+func bytesBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
+	v, err := a.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	av, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for %v operator, want bytes", ErrInvalidType, v, OpToStr[op])
+	}
+	v, err = b.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bv, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w %T for %v operator, want bytes", ErrInvalidType, v, OpToStr[op])
+	}
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		return compareResult(op, bytes.Compare(av, bv), true), nil
+	default:
+		return nil, fmt.Errorf("%w bytes for %v operator", ErrInvalidType, OpToStr[op])
+	}
+}
+
 func enumBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
 	atyp, aerr := a.Type(ctx)
 	if aerr != nil {
@@ -662,12 +2428,25 @@ func enumBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
 // isAllProps is a helper function that traverses the expression tree and returns
 // true if all the expressions are either properties, boolean-evaluating expressions
 // or binary expressions whose operands evaluate to booleans.
+// hasProperties returns true if the expression refers to the properties of
+// the context message.
+func hasProperties(e Expression) bool {
+	found := false
+	walkExpr(e, func(e Expression) error {
+		if _, ok := e.(*PropertyExpr); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
 func isAllPropertyExprs(e Expression) bool {
 	if e == nil {
 		return false
 	}
 	switch e.(type) {
-	case *PropertyExpr:
+	case *PropertyExpr, *PathExpr, *InExpr:
 		return true
 	case *BinaryExpr:
 		be := e.(*BinaryExpr)
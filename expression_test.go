@@ -2,6 +2,8 @@ package protoquery
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"testing"
 
 	"github.com/osdrv/protoquery/proto"
@@ -96,6 +98,26 @@ func TestExpressionType(t *testing.T) {
 			ctx:  NewEvalContext(nil),
 			want: TypeInt,
 		},
+		{
+			name: "binary addition expression with mixed signedness",
+			input: &BinaryExpr{
+				left:  NewLiteralExpr(uint64(42), TypeUint),
+				right: NewLiteralExpr(int64(2), TypeInt),
+				op:    OpPlus,
+			},
+			ctx:  NewEvalContext(nil),
+			want: TypeInt,
+		},
+		{
+			name: "binary subtraction expression with unsigned integers",
+			input: &BinaryExpr{
+				left:  NewLiteralExpr(uint64(42), TypeUint),
+				right: NewLiteralExpr(uint64(2), TypeUint),
+				op:    OpMinus,
+			},
+			ctx:  NewEvalContext(nil),
+			want: TypeUint,
+		},
 		{
 			name: "binary comparison with integers",
 			input: &BinaryExpr{
@@ -140,6 +162,10 @@ func TestExpressionEval(t *testing.T) {
 
 	msgEmpty := &proto.Book{}
 
+	store := &proto.Bookstore{
+		Books: []*proto.Book{msg},
+	}
+
 	tests := []struct {
 		name    string
 		input   Expression
@@ -581,6 +607,24 @@ func TestExpressionEval(t *testing.T) {
 			ctx:  NewEvalContext(msg.ProtoReflect(), WithEnforceBool(true)),
 			want: true,
 		},
+		{
+			name:  "absolute path with a root message",
+			input: NewAbsolutePathExpr(Query{&RootQueryStep{}, &NodeQueryStep{name: "books"}}),
+			ctx:   NewEvalContext(msgEmpty.ProtoReflect(), WithEnforceBool(true), WithRoot(store.ProtoReflect())),
+			want:  true,
+		},
+		{
+			name:    "absolute path without a root message",
+			input:   NewAbsolutePathExpr(Query{&RootQueryStep{}, &NodeQueryStep{name: "books"}}),
+			ctx:     NewEvalContext(msgEmpty.ProtoReflect(), WithEnforceBool(true)),
+			wantErr: fmt.Errorf("Absolute path /books requires a root message"),
+		},
+		{
+			name:    "relative path without an evaluation scope",
+			input:   NewPathExpr(Query{&ParentQueryStep{}}),
+			ctx:     NewEvalContext(msgEmpty.ProtoReflect(), WithEnforceBool(true)),
+			wantErr: fmt.Errorf("Path expression .. requires a query evaluation scope"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -643,3 +687,42 @@ func TestIsAllPropertyExprs(t *testing.T) {
 		})
 	}
 }
+
+func TestCompareNumbers(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        any
+		want        int
+		wantOrdered bool
+	}{
+		{name: "ints", a: int64(1), b: int32(2), want: -1, wantOrdered: true},
+		{name: "uints", a: uint64(math.MaxUint64), b: uint32(1), want: 1, wantOrdered: true},
+		{name: "negative int and uint", a: int64(-1), b: uint64(math.MaxUint64), want: -1, wantOrdered: true},
+		{name: "uint beyond int64", a: uint64(1 << 63), b: int64(math.MaxInt64), want: 1, wantOrdered: true},
+		{name: "int and float", a: int64(2), b: 2.0, want: 0, wantOrdered: true},
+		{name: "int and fractional float", a: int64(2), b: 2.5, want: -1, wantOrdered: true},
+		{name: "negative int and fractional float", a: int64(-2), b: -2.5, want: 1, wantOrdered: true},
+		{name: "large int and float", a: int64(math.MaxInt64), b: float64(math.MaxInt64), want: -1, wantOrdered: true},
+		{name: "uint and negative float", a: uint64(0), b: -0.5, want: 1, wantOrdered: true},
+		{name: "float and uint", a: 1e20, b: uint64(math.MaxUint64), want: 1, wantOrdered: true},
+		{name: "float32 and float64", a: float32(0.1), b: 0.1, want: 0, wantOrdered: true},
+		{name: "float64s", a: 0.1, b: float64(float32(0.1)), want: -1, wantOrdered: true},
+		{name: "NaN", a: math.NaN(), b: int64(1), wantOrdered: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ordered, err := compareNumbers(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("compareNumbers() error = %v, no error expected", err)
+			}
+			if ordered != tt.wantOrdered || (ordered && got != tt.want) {
+				t.Errorf("compareNumbers() = %v, %v, want %v, %v", got, ordered, tt.want, tt.wantOrdered)
+			}
+		})
+	}
+
+	if _, _, err := compareNumbers("1", int64(1)); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("compareNumbers() error = %v, want %v", err, ErrInvalidType)
+	}
+}
@@ -0,0 +1,285 @@
+package protoquery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Signature declares the argument and the return types of a function.
+type Signature struct {
+	// Args is the list of the argument types. TypeUnknown stands for any type.
+	// TypeNodeSet arguments are passed as is, the rest are evaluated to scalars:
+	// unset properties evaluate to the default values and node sets to the
+	// value of the first node.
+	Args []Type
+	// Optional is the number of the trailing optional arguments.
+	Optional int
+	// Variadic indicates that the last argument could be repeated.
+	Variadic bool
+	// Returns is the type of the returned value.
+	Returns Type
+}
+
+// FunctionImpl is a user-defined function implementation. ctx is the context
+// of the query evaluation (see FindAllContext), ectx is the evaluation context
+// of the function call and args are the evaluated arguments.
+type FunctionImpl func(ctx context.Context, ectx EvalContext, args []any) (any, error)
+
+// FunctionSet is a set of user-defined functions. Use WithFunctions to make
+// the functions available to a single query.
+type FunctionSet struct {
+	funcs map[string]*Builtin
+}
+
+// NewFunctionSet returns an empty function set.
+func NewFunctionSet() *FunctionSet {
+	return &FunctionSet{
+		funcs: make(map[string]*Builtin),
+	}
+}
+
+// Register adds the function to the set. It fails if the name is not a valid
+// function name or it is taken by a built-in function.
+func (fs *FunctionSet) Register(name string, sig Signature, impl FunctionImpl) error {
+	if err := validateFunction(name, sig, impl); err != nil {
+		return err
+	}
+	fs.funcs[name] = newUserBuiltin(name, sig, impl)
+	return nil
+}
+
+func (fs *FunctionSet) lookup(name string) (*Builtin, bool) {
+	if fs == nil {
+		return nil, false
+	}
+	fn, ok := fs.funcs[name]
+	return fn, ok
+}
+
+var (
+	registry   = NewFunctionSet()
+	registryMu sync.RWMutex
+)
+
+// RegisterFunction registers the function globally: it becomes available to
+// all the queries compiled afterwards. It fails if the name is not a valid
+// function name or it is taken by a built-in function.
+func RegisterFunction(name string, sig Signature, impl FunctionImpl) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return registry.Register(name, sig, impl)
+}
+
+// WithFunctions makes the function set available to the compiled query.
+// The set functions take precedence over the globally registered ones.
+func WithFunctions(fs *FunctionSet) CompileOption {
+	return func(pq *ProtoQuery) {
+		pq.funcs = fs
+	}
+}
+
+func validateFunction(name string, sig Signature, impl FunctionImpl) error {
+	if node, ix := readNode(name, 0); node == "" || ix != len(name) {
+		return fmt.Errorf("%w: invalid function name %q", ErrInvalidArgs, name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("%w: function %v is built-in", ErrInvalidArgs, name)
+	}
+	if impl == nil {
+		return fmt.Errorf("%w: function %v has no implementation", ErrInvalidArgs, name)
+	}
+	if sig.Optional < 0 || sig.Optional > len(sig.Args) || (sig.Variadic && len(sig.Args) == 0) {
+		return fmt.Errorf("%w: function %v has an invalid signature", ErrInvalidArgs, name)
+	}
+	return nil
+}
+
+// newUserBuiltin adapts the user-defined function to the built-in function
+// interface: the arguments are evaluated before the call and the returned
+// value is checked against the signature.
+func newUserBuiltin(name string, sig Signature, impl FunctionImpl) *Builtin {
+	return &Builtin{
+		body: func(ectx EvalContext, args []Expression) (any, error) {
+			vals := make([]any, 0, len(args))
+			for i, arg := range args {
+				var v any
+				var err error
+				if sig.Args[min(i, len(sig.Args)-1)] == TypeNodeSet {
+					v, err = arg.Eval(ectx.Copy(WithEnforceBool(false)))
+				} else {
+					v, err = argValue(ectx, arg)
+				}
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, v)
+			}
+			ctx := context.Background()
+			if scope := ectx.Options().scope; scope != nil {
+				ctx = scope.ev.ctx
+			}
+			v, err := impl(ctx, ectx, vals)
+			if err != nil {
+				return nil, err
+			}
+			return returnValue(name, sig.Returns, v)
+		},
+		typ:      sig.Returns,
+		args:     sig.Args,
+		optional: sig.Optional,
+		variadic: sig.Variadic,
+	}
+}
+
+// returnValue normalizes the value returned by the user-defined function the
+// same way as the bound variables are normalized (see bindValue) and checks it
+// against the declared return type. TypeUnknown stands for any type and enums
+// are represented by their names.
+func returnValue(name string, want Type, v any) (any, error) {
+	if want == TypeUnknown {
+		return v, nil
+	}
+	rv, typ, err := bindValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v() returned %T", ErrInvalidType, name, v)
+	}
+	if typ != want && !(want == TypeEnum && typ == TypeString) {
+		return nil, fmt.Errorf("%w: %v() returned %v, want %v", ErrInvalidType, name, TypeToStr[typ], TypeToStr[want])
+	}
+	return rv, nil
+}
+
+// lookupFunction resolves the function by name: the built-in functions go
+// first, then the given function set and the global registry.
+func lookupFunction(name string, fs *FunctionSet) (*Builtin, bool) {
+	if fn, ok := builtins[name]; ok {
+		return &fn, true
+	}
+	if fn, ok := fs.lookup(name); ok {
+		return fn, true
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry.lookup(name)
+}
+
+// resolveFunctions binds the function calls of the query to the function
+// implementations and checks the arity and the types of the arguments which
+// are known at compile time.
+func resolveFunctions(pq *ProtoQuery) error {
+	resolve := func(e Expression) error {
+		call, ok := e.(*FunctionCallExpr)
+		if !ok {
+			return nil
+		}
+		fn, ok := lookupFunction(call.handle, pq.funcs)
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnknownFunction, call.handle)
+		}
+		if err := fn.checkArity(call.handle, call.args); err != nil {
+			return err
+		}
+		for i, arg := range call.args {
+			want := fn.args[min(i, len(fn.args)-1)]
+			typ, ok := staticType(arg)
+			if !ok || want == TypeUnknown {
+				continue
+			}
+			if !argTypeFits(typ, want) {
+				return fmt.Errorf("%w %v for argument %d of %v(), want %v", ErrInvalidType, TypeToStr[typ], i+1, call.handle, TypeToStr[want])
+			}
+		}
+		call.fn = fn
+		return nil
+	}
+	if pq.expr != nil {
+		return walkExpr(pq.expr, resolve)
+	}
+	for _, path := range pq.tree.paths() {
+		if err := walkQueryExprs(path, resolve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staticType returns the type of the expression if it does not depend on
+// the evaluation context.
+func staticType(e Expression) (Type, bool) {
+	switch ex := e.(type) {
+	case *LiteralExpr:
+		return ex.typ, true
+	case *RegexExpr:
+		return TypeString, true
+	case *FunctionCallExpr:
+		if ex.fn == nil || ex.fn.typ == TypeUnknown {
+			return TypeUnknown, false
+		}
+		return ex.fn.typ, true
+	}
+	return TypeUnknown, false
+}
+
+// walkExpr calls fn on the expression and its sub-expressions, the innermost
+// ones go first.
+func walkExpr(e Expression, fn func(Expression) error) error {
+	switch ex := e.(type) {
+	case *BinaryExpr:
+		if err := walkExpr(ex.left, fn); err != nil {
+			return err
+		}
+		if err := walkExpr(ex.right, fn); err != nil {
+			return err
+		}
+	case *UnaryExpr:
+		if err := walkExpr(ex.expr, fn); err != nil {
+			return err
+		}
+	case *FunctionCallExpr:
+		for _, arg := range ex.args {
+			if err := walkExpr(arg, fn); err != nil {
+				return err
+			}
+		}
+	case *ListExpr:
+		for _, elem := range ex.elems {
+			if err := walkExpr(elem, fn); err != nil {
+				return err
+			}
+		}
+	case *InExpr:
+		if err := walkExpr(ex.expr, fn); err != nil {
+			return err
+		}
+		if err := walkExpr(ex.list, fn); err != nil {
+			return err
+		}
+	case *PathExpr:
+		if err := walkQueryExprs(ex.query, fn); err != nil {
+			return err
+		}
+	case *SliceExpr:
+		for _, b := range []Expression{ex.start, ex.stop, ex.step} {
+			if b == nil {
+				continue
+			}
+			if err := walkExpr(b, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return fn(e)
+}
+
+// walkQueryExprs calls walkExpr on every key step expression of the query.
+func walkQueryExprs(query Query, fn func(Expression) error) error {
+	for _, step := range query {
+		if ks, ok := step.(*KeyQueryStep); ok {
+			if err := walkExpr(ks.expr, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
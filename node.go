@@ -0,0 +1,222 @@
+package protoquery
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// pathElem is a single element of a value lineage. It is either a message
+// field access, a container element access (a list index or a map key) or
+// a string or bytes slice.
+type pathElem struct {
+	prev *pathElem
+	// fd is set for message field accesses.
+	fd protoreflect.FieldDescriptor
+	// index is set for list and bytes element accesses. It is -1 otherwise.
+	index int
+	// key is set for map element accesses.
+	key protoreflect.MapKey
+	// slice is set for string and bytes slices, e.g.: `1:3`.
+	slice string
+}
+
+func fieldPathElem(prev *pathElem, fd protoreflect.FieldDescriptor) *pathElem {
+	return &pathElem{prev: prev, fd: fd, index: -1}
+}
+
+func indexPathElem(prev *pathElem, index int) *pathElem {
+	return &pathElem{prev: prev, index: index}
+}
+
+func keyPathElem(prev *pathElem, key protoreflect.MapKey) *pathElem {
+	return &pathElem{prev: prev, key: key, index: -1}
+}
+
+func slicePathElem(prev *pathElem, slice string) *pathElem {
+	return &pathElem{prev: prev, slice: slice, index: -1}
+}
+
+// String returns a canonical path from the root message to the element.
+func (pe *pathElem) String() string {
+	elems := pe.elems()
+	if len(elems) == 0 {
+		return "/"
+	}
+	var b strings.Builder
+	for _, e := range elems {
+		switch {
+		case e.fd != nil:
+			b.WriteString("/")
+			b.WriteString(string(e.fd.Name()))
+		case e.index >= 0:
+			b.WriteString("[")
+			b.WriteString(strconv.Itoa(e.index))
+			b.WriteString("]")
+		case e.key.IsValid():
+			b.WriteString("[")
+			b.WriteString(formatMapKey(e.key))
+			b.WriteString("]")
+		case e.slice != "":
+			b.WriteString("[")
+			b.WriteString(e.slice)
+			b.WriteString("]")
+		}
+	}
+	return b.String()
+}
+
+// comparePaths compares the element locations in the document order: fields
+// are ordered by the field number, list elements by the index and map
+// entries by the key. A parent precedes its descendants.
+func comparePaths(a, b *pathElem) int {
+	as, bs := a.elems(), b.elems()
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := comparePathElems(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+func comparePathElems(a, b *pathElem) int {
+	switch {
+	case a.fd != nil && b.fd != nil:
+		return cmp.Compare(a.fd.Number(), b.fd.Number())
+	case a.index >= 0 && b.index >= 0:
+		return cmp.Compare(a.index, b.index)
+	case a.key.IsValid() && b.key.IsValid():
+		return compareMapKeys(a.key, b.key)
+	case a.slice != "" && b.slice != "":
+		return strings.Compare(a.slice, b.slice)
+	}
+	return 0
+}
+
+func compareMapKeys(a, b protoreflect.MapKey) int {
+	switch av := a.Interface().(type) {
+	case bool:
+		bv, _ := b.Interface().(bool)
+		if av == bv {
+			return 0
+		} else if !av {
+			return -1
+		}
+		return 1
+	case string:
+		return cmp.Compare(av, b.String())
+	case int32, int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case uint32, uint64:
+		return cmp.Compare(a.Uint(), b.Uint())
+	}
+	return 0
+}
+
+// elems returns the path elements starting from the root.
+func (pe *pathElem) elems() []*pathElem {
+	res := []*pathElem{}
+	for e := pe; e != nil; e = e.prev {
+		res = append(res, e)
+	}
+	slices.Reverse(res)
+	return res
+}
+
+// formatMapKey formats the map key as a query literal. The string keys are
+// quoted so that the quotes they contain need no escaping if possible,
+// otherwise the single quotes are doubled (see readString).
+func formatMapKey(k protoreflect.MapKey) string {
+	switch v := k.Interface().(type) {
+	case string:
+		switch {
+		case !strings.Contains(v, "'"):
+			return "'" + v + "'"
+		case !strings.Contains(v, `"`):
+			return `"` + v + `"`
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Node is a query result enriched with its location in the root message.
+type Node struct {
+	item queueItem
+}
+
+// valueNode returns a node of a value detached from any message, e.g.: an
+// element of a list bound to a variable. The node has no location.
+func valueNode(v protoreflect.Value) Node {
+	return Node{item: queueItem{ptr: v}}
+}
+
+// Value returns the matching value. Unlike the values returned by FindAll,
+// enum values are represented by their numbers, so that the value could be
+// set through the descriptor.
+func (n Node) Value() protoreflect.Value {
+	fd, pe := n.item.descr, n.item.path
+	if fd != nil && fd.Kind() == protoreflect.EnumKind && pe != nil && pe.fd == fd {
+		// The enum field values are selected by their names.
+		if name, ok := n.item.ptr.Interface().(string); ok {
+			if ev := fd.Enum().Values().ByName(protoreflect.Name(name)); ev != nil {
+				return protoreflect.ValueOfEnum(ev.Number())
+			}
+		}
+	}
+	return n.item.ptr
+}
+
+// Interface returns the underlying Go value, identical to the one returned
+// by FindAll.
+func (n Node) Interface() any {
+	return stripProto(n.item.ptr)
+}
+
+// Descriptor returns the descriptor of the field holding the value. For list
+// elements it is the list field descriptor, for map values it is the map value
+// descriptor. It is nil for the root message.
+func (n Node) Descriptor() protoreflect.FieldDescriptor {
+	return n.item.descr
+}
+
+// Parent returns the message containing the value. It is nil for the root message.
+func (n Node) Parent() protoreflect.Message {
+	if n.item.parent == nil {
+		return nil
+	}
+	msg, _ := toMessage(n.item.parent.ptr)
+	return msg
+}
+
+// Path returns a canonical path of the value, e.g.: `/people[2]/phones[0]/number`
+// or `/string_inner_map['k']/inner_int`. The string and bytes slices have
+// the resolved bounds, e.g.: `/people[0]/name[0:3]`.
+func (n Node) Path() string {
+	return n.item.path.String()
+}
+
+func (n Node) String() string {
+	return n.Path()
+}
+
+// NodeSet is a result of a path expression evaluation.
+type NodeSet []Node
+
+func (ns NodeSet) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, n := range ns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(n.Path())
+	}
+	b.WriteString("}")
+	return b.String()
+}
@@ -1,6 +1,11 @@
 package protoquery
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
 
 type (
 	parsePrefixFn func([]*Token, int, int) (Expression, int, error)
@@ -9,6 +14,8 @@ type (
 
 const (
 	LOWEST int = iota
+	OR
+	AND
 	EQUALS
 	COMPARE
 	SUM
@@ -26,6 +33,7 @@ var (
 		TokenMinus:        OpMinus,
 		TokenStar:         OpMul,
 		TokenSlash:        OpDiv,
+		TokenPercent:      OpMod,
 		TokenEqual:        OpEq,
 		TokenNotEqual:     OpNe,
 		TokenAnd:          OpAnd,
@@ -34,32 +42,41 @@ var (
 		TokenLessEqual:    OpLe,
 		TokenGreater:      OpGt,
 		TokenGreaterEqual: OpGe,
+		TokenMatch:        OpMatch,
 	}
 
 	precedences = map[TokenKind]int{
 		TokenEqual:        EQUALS,
 		TokenNotEqual:     EQUALS,
+		TokenMatch:        EQUALS,
 		TokenLess:         COMPARE,
 		TokenLessEqual:    COMPARE,
 		TokenGreater:      COMPARE,
 		TokenGreaterEqual: COMPARE,
 		TokenPlus:         SUM,
 		TokenMinus:        SUM,
-		TokenAnd:          SUM,
-		TokenOr:           SUM,
+		TokenAnd:          AND,
+		TokenOr:           OR,
 		TokenSlash:        MULTIPLY,
 		TokenStar:         MULTIPLY,
+		TokenPercent:      MULTIPLY,
 	}
 )
 
 func init() {
 	parsePrefixFns[TokenAt] = parsePropertyExpression
-	parsePrefixFns[TokenNode] = parseFunctionExpression
+	parsePrefixFns[TokenNode] = parseNodeExpression
+	parsePrefixFns[TokenDotDot] = parsePathExpression
+	parsePrefixFns[TokenDot] = parseSelfExpression
+	parsePrefixFns[TokenSlash] = parseAbsolutePathExpression
+	parsePrefixFns[TokenSlashSlash] = parseAbsolutePathExpression
+	parsePrefixFns[TokenVariable] = parseVariableExpression
 
 	parsePrefixFns[TokenInt] = parseLiteralExpression
 	parsePrefixFns[TokenFloat] = parseLiteralExpression
 	parsePrefixFns[TokenBool] = parseLiteralExpression
 	parsePrefixFns[TokenString] = parseLiteralExpression
+	parsePrefixFns[TokenBytes] = parseLiteralExpression
 
 	parsePrefixFns[TokenBang] = parseUnaryExpression
 	parsePrefixFns[TokenPlus] = parseUnaryExpression
@@ -68,6 +85,7 @@ func init() {
 
 	parseInfixFns[TokenEqual] = parseBinaryExpression
 	parseInfixFns[TokenNotEqual] = parseBinaryExpression
+	parseInfixFns[TokenMatch] = parseBinaryExpression
 	parseInfixFns[TokenLess] = parseBinaryExpression
 	parseInfixFns[TokenLessEqual] = parseBinaryExpression
 	parseInfixFns[TokenGreater] = parseBinaryExpression
@@ -76,11 +94,15 @@ func init() {
 	parseInfixFns[TokenMinus] = parseBinaryExpression
 	parseInfixFns[TokenSlash] = parseBinaryExpression
 	parseInfixFns[TokenStar] = parseBinaryExpression
+	parseInfixFns[TokenPercent] = parseBinaryExpression
 	parseInfixFns[TokenAnd] = parseBinaryExpression
 	parseInfixFns[TokenOr] = parseBinaryExpression
 }
 
 func parseExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	if ix >= len(tokens) {
+		return nil, ix, fmt.Errorf("unexpected end of expression")
+	}
 	prefix, ok := parsePrefixFns[tokens[ix].Kind]
 	if !ok {
 		return nil, ix, fmt.Errorf("unexpected prefix token %v", tokens[ix].Value)
@@ -88,24 +110,128 @@ func parseExpression(tokens []*Token, ix int, precedence int) (Expression, int,
 	var leftExpr Expression
 	var err error
 	leftExpr, ix, err = prefix(tokens, ix, precedence)
+	if err != nil {
+		return nil, ix, err
+	}
 
-	if ix < len(tokens) && precedence < precedences[tokens[ix].Kind] {
-		infix, ok := parseInfixFns[tokens[ix].Kind]
-		if !ok {
-			return nil, ix, fmt.Errorf("unexpected infix token %v", tokens[ix].Value)
+	for ix < len(tokens) {
+		if negate, n, ok := matchInOperator(tokens, ix); ok {
+			if precedence >= EQUALS {
+				break
+			}
+			leftExpr, ix, err = parseInExpression(tokens, ix+n, leftExpr, negate)
+		} else {
+			if precedence >= precedences[tokens[ix].Kind] {
+				break
+			}
+			infix, ok := parseInfixFns[tokens[ix].Kind]
+			if !ok {
+				return nil, ix, fmt.Errorf("unexpected infix token %v", tokens[ix].Value)
+			}
+			leftExpr, ix, err = infix(tokens, ix, leftExpr, precedence)
+		}
+		if err != nil {
+			return nil, ix, err
 		}
-		leftExpr, ix, err = infix(tokens, ix, leftExpr, precedence)
 	}
 
-	return leftExpr, ix, err
+	return leftExpr, ix, nil
+}
+
+// matchInOperator matches the `in` and `not in` membership operators. It returns
+// the number of the operator tokens.
+func matchInOperator(tokens []*Token, ix int) (negate bool, n int, ok bool) {
+	switch {
+	case matchToken(tokens, ix, TokenNode) && tokens[ix].Value == "in":
+		return false, 1, true
+	case matchToken(tokens, ix, TokenNode) && tokens[ix].Value == "not" &&
+		matchToken(tokens, ix+1, TokenNode) && tokens[ix+1].Value == "in":
+		return true, 2, true
+	}
+	return false, 0, false
+}
+
+// parseInExpression parses the membership operator right operand, e.g.:
+// `('PHONE_TYPE_WORK', 'PHONE_TYPE_HOME')` in `@type in ('PHONE_TYPE_WORK', 'PHONE_TYPE_HOME')`.
+// A parenthesized operand is always a literal list, even a single-element one,
+// e.g.: `@id in (1)`.
+func parseInExpression(tokens []*Token, ix int, left Expression, negate bool) (Expression, int, error) {
+	var right Expression
+	var err error
+	switch {
+	case matchToken(tokens, ix, TokenLParen) && matchToken(tokens, ix+1, TokenRParen):
+		right, err = NewListExpr(nil)
+		ix += 2
+	case matchToken(tokens, ix, TokenLParen):
+		var first Expression
+		if first, ix, err = parseExpression(tokens, ix+1, LOWEST); err != nil {
+			return nil, ix, err
+		}
+		right, ix, err = parseListExpression(tokens, ix, first)
+	default:
+		right, ix, err = parseExpression(tokens, ix, EQUALS)
+	}
+	if err != nil {
+		return nil, ix, err
+	}
+	return NewInExpr(left, right, negate), ix, nil
 }
 
 func parsePropertyExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
 	ix++
 	if !matchTokenAny(tokens, ix, TokenNode, TokenStar) {
-		return nil, ix, fmt.Errorf("expected node or '*', got %v", tokens[ix].Value)
+		return nil, ix, fmt.Errorf("expected node or '*', got %v", tokenValue(tokens, ix))
+	}
+	expr := &PropertyExpr{name: tokens[ix].Value}
+	ix++
+	// Dotted access to the nested message fields, e.g.: `@address.city`.
+	for matchToken(tokens, ix, TokenDot) && matchToken(tokens, ix+1, TokenNode) {
+		expr.path = append(expr.path, expr.name)
+		expr.name = tokens[ix+1].Value
+		ix += 2
+	}
+	return expr, ix, nil
+}
+
+// parseNodeExpression parses either a function call or a relative path, e.g.:
+// `length()` or `phones/type`.
+func parseNodeExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	if matchToken(tokens, ix+1, TokenLParen) {
+		return parseFunctionExpression(tokens, ix, precedence)
+	}
+	return parsePathExpression(tokens, ix, precedence)
+}
+
+func parsePathExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	query, ix, err := compileRelativePath(tokens, ix)
+	if err != nil {
+		return nil, ix, err
 	}
-	return &PropertyExpr{tokens[ix].Value}, ix + 1, nil
+	return NewPathExpr(query), ix, nil
+}
+
+func parseAbsolutePathExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	query, ix, err := compileAbsolutePath(tokens, ix)
+	if err != nil {
+		return nil, ix, err
+	}
+	return NewAbsolutePathExpr(query), ix, nil
+}
+
+func parseVariableExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	if tokens[ix].Value == "root" {
+		return parseAbsolutePathExpression(tokens, ix, precedence)
+	}
+	return NewVariableExpr(tokens[ix].Value), ix + 1, nil
+}
+
+func parseSelfExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	// A dot followed by a path step is a relative path, e.g.: `./name`.
+	if matchTokenAny(tokens, ix+1, TokenSlash, TokenSlashSlash) &&
+		matchTokenAny(tokens, ix+2, TokenDot, TokenDotDot, TokenNode, TokenStar, TokenAt) {
+		return parsePathExpression(tokens, ix, precedence)
+	}
+	return NewSelfExpr(), ix + 1, nil
 }
 
 func parseFunctionExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
@@ -114,7 +240,7 @@ func parseFunctionExpression(tokens []*Token, ix int, precedence int) (Expressio
 	}
 	ix++
 	if !matchToken(tokens, ix, TokenLParen) {
-		return nil, ix, fmt.Errorf("expected '(', got %v", tokens[ix].Value)
+		return nil, ix, fmt.Errorf("expected '(', got %v", tokenValue(tokens, ix))
 	}
 	ix++
 	if !matchToken(tokens, ix, TokenRParen) {
@@ -135,17 +261,48 @@ func parseFunctionExpression(tokens []*Token, ix int, precedence int) (Expressio
 		expr.args = args
 	}
 	if !matchToken(tokens, ix, TokenRParen) {
-		return nil, ix, fmt.Errorf("expected ')', got %v", tokens[ix].Value)
+		return nil, ix, fmt.Errorf("expected ')', got %v", tokenValue(tokens, ix))
 	}
 	ix++
+	if expr.handle == "matches" && len(expr.args) > 1 {
+		// Literal patterns are compiled once.
+		var err error
+		if expr.args[1], err = compileRegexLiteral(expr.args[1]); err != nil {
+			return nil, ix, err
+		}
+	}
 	return expr, ix, nil
 }
 
+// compileRegexLiteral compiles the string literal into a regular expression.
+// Any other expression is returned as is and is compiled in the runtime.
+func compileRegexLiteral(e Expression) (Expression, error) {
+	lit, ok := e.(*LiteralExpr)
+	if !ok || lit.typ != TypeString {
+		return e, nil
+	}
+	re, err := regexp.Compile(lit.value.(string))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRegex, err)
+	}
+	return NewRegexExpr(re), nil
+}
+
 func parseLiteralExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
 	expr := &LiteralExpr{}
 	switch tokens[ix].Kind {
 	case TokenInt:
 		intv, err := tokens[ix].IntValue()
+		if errors.Is(err, strconv.ErrRange) {
+			// The literals beyond the int64 range are unsigned.
+			uintv, err := tokens[ix].UintValue()
+			if err != nil {
+				return nil, ix, err
+			}
+			expr.value = uintv
+			expr.typ = TypeUint
+			break
+		}
 		if err != nil {
 			return nil, ix, err
 		}
@@ -165,6 +322,13 @@ func parseLiteralExpression(tokens []*Token, ix int, precedence int) (Expression
 		}
 		expr.value = boolv
 		expr.typ = TypeBool
+	case TokenBytes:
+		bytesv, err := tokens[ix].BytesValue()
+		if err != nil {
+			return nil, ix, err
+		}
+		expr.value = bytesv
+		expr.typ = TypeBytes
 	default:
 		expr.value = tokens[ix].Value
 		expr.typ = TypeString
@@ -190,19 +354,51 @@ func parseUnaryExpression(tokens []*Token, ix int, precedence int) (Expression,
 	return expr, ix, nil
 }
 
+// parseGroupExpression parses either a parenthesized expression or a literal
+// list, e.g.: `(1, 2, 3)`.
 func parseGroupExpression(tokens []*Token, ix int, precedence int) (Expression, int, error) {
+	if matchToken(tokens, ix+1, TokenRParen) {
+		list, err := NewListExpr(nil)
+		return list, ix + 2, err
+	}
 	var group Expression
 	var err error
 	group, ix, err = parseExpression(tokens, ix+1, LOWEST)
 	if err != nil {
 		return nil, ix, err
 	}
-	if tokens[ix].Kind != TokenRParen {
-		return nil, ix, fmt.Errorf("expected ')', got %v", tokens[ix].Value)
+	if matchToken(tokens, ix, TokenComma) {
+		return parseListExpression(tokens, ix, group)
+	}
+	if !matchToken(tokens, ix, TokenRParen) {
+		return nil, ix, fmt.Errorf("expected ')', got %v", tokenValue(tokens, ix))
 	}
 	return group, ix + 1, nil
 }
 
+// parseListExpression parses the rest of a literal list starting from the
+// comma after the first element.
+func parseListExpression(tokens []*Token, ix int, first Expression) (Expression, int, error) {
+	elems := []Expression{first}
+	for matchToken(tokens, ix, TokenComma) {
+		var elem Expression
+		var err error
+		elem, ix, err = parseExpression(tokens, ix+1, LOWEST)
+		if err != nil {
+			return nil, ix, err
+		}
+		elems = append(elems, elem)
+	}
+	if !matchToken(tokens, ix, TokenRParen) {
+		return nil, ix, fmt.Errorf("expected ')', got %v", tokenValue(tokens, ix))
+	}
+	list, err := NewListExpr(elems)
+	if err != nil {
+		return nil, ix, err
+	}
+	return list, ix + 1, nil
+}
+
 func parseBinaryExpression(tokens []*Token, ix int, left Expression, precedence int) (Expression, int, error) {
 	op, ok := TokenOpMap[tokens[ix].Kind]
 	if !ok {
@@ -214,11 +410,18 @@ func parseBinaryExpression(tokens []*Token, ix int, left Expression, precedence
 	}
 	var right Expression
 	var err error
-	right, ix, err = parseExpression(tokens, ix+1, precedence)
+	// The operators of the same precedence are left-associative.
+	right, ix, err = parseExpression(tokens, ix+1, precedences[tokens[ix].Kind])
 	if err != nil {
 		return nil, ix, err
 	}
 	expr.right = right
+	if op == OpMatch {
+		// Literal patterns are compiled once.
+		if expr.right, err = compileRegexLiteral(right); err != nil {
+			return nil, ix, err
+		}
+	}
 
 	return expr, ix, nil
 }
@@ -62,6 +62,33 @@ func TestParseExpression(t *testing.T) {
 				name: "*",
 			},
 		},
+		{
+			name: "dotted property",
+			tokens: []*Token{
+				NewToken("@", TokenAt),
+				NewToken("address", TokenNode),
+				NewToken(".", TokenDot),
+				NewToken("city", TokenNode),
+			},
+			want: &PropertyExpr{
+				name: "city",
+				path: []string{"address"},
+			},
+		},
+		{
+			name: "relative path",
+			tokens: []*Token{
+				NewToken("phones", TokenNode),
+				NewToken("/", TokenSlash),
+				NewToken("type", TokenNode),
+			},
+			want: &PathExpr{
+				query: Query{
+					&NodeQueryStep{name: "phones"},
+					&NodeQueryStep{name: "type"},
+				},
+			},
+		},
 		{
 			name: "basic function call",
 			tokens: []*Token{
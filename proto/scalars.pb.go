@@ -0,0 +1,417 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.1
+// 	protoc        v5.27.0
+// source: proto/scalars.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Scalars_Enum int32
+
+const (
+	Scalars_ENUM_UNSPECIFIED Scalars_Enum = 0
+	Scalars_ENUM_ONE         Scalars_Enum = 1
+)
+
+// Enum value maps for Scalars_Enum.
+var (
+	Scalars_Enum_name = map[int32]string{
+		0: "ENUM_UNSPECIFIED",
+		1: "ENUM_ONE",
+	}
+	Scalars_Enum_value = map[string]int32{
+		"ENUM_UNSPECIFIED": 0,
+		"ENUM_ONE":         1,
+	}
+)
+
+func (x Scalars_Enum) Enum() *Scalars_Enum {
+	p := new(Scalars_Enum)
+	*p = x
+	return p
+}
+
+func (x Scalars_Enum) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Scalars_Enum) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_scalars_proto_enumTypes[0].Descriptor()
+}
+
+func (Scalars_Enum) Type() protoreflect.EnumType {
+	return &file_proto_scalars_proto_enumTypes[0]
+}
+
+func (x Scalars_Enum) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Scalars_Enum.Descriptor instead.
+func (Scalars_Enum) EnumDescriptor() ([]byte, []int) {
+	return file_proto_scalars_proto_rawDescGZIP(), []int{1, 0}
+}
+
+// ScalarsHolder holds messages with a field of every scalar kind.
+type ScalarsHolder struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Items []*Scalars `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+}
+
+func (x *ScalarsHolder) Reset() {
+	*x = ScalarsHolder{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_scalars_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScalarsHolder) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScalarsHolder) ProtoMessage() {}
+
+func (x *ScalarsHolder) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_scalars_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScalarsHolder.ProtoReflect.Descriptor instead.
+func (*ScalarsHolder) Descriptor() ([]byte, []int) {
+	return file_proto_scalars_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScalarsHolder) GetItems() []*Scalars {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type Scalars struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	DoubleField   float64      `protobuf:"fixed64,1,opt,name=double_field,json=doubleField,proto3" json:"double_field,omitempty"`
+	FloatField    float32      `protobuf:"fixed32,2,opt,name=float_field,json=floatField,proto3" json:"float_field,omitempty"`
+	Int32Field    int32        `protobuf:"varint,3,opt,name=int32_field,json=int32Field,proto3" json:"int32_field,omitempty"`
+	Int64Field    int64        `protobuf:"varint,4,opt,name=int64_field,json=int64Field,proto3" json:"int64_field,omitempty"`
+	Uint32Field   uint32       `protobuf:"varint,5,opt,name=uint32_field,json=uint32Field,proto3" json:"uint32_field,omitempty"`
+	Uint64Field   uint64       `protobuf:"varint,6,opt,name=uint64_field,json=uint64Field,proto3" json:"uint64_field,omitempty"`
+	Sint32Field   int32        `protobuf:"zigzag32,7,opt,name=sint32_field,json=sint32Field,proto3" json:"sint32_field,omitempty"`
+	Sint64Field   int64        `protobuf:"zigzag64,8,opt,name=sint64_field,json=sint64Field,proto3" json:"sint64_field,omitempty"`
+	Fixed32Field  uint32       `protobuf:"fixed32,9,opt,name=fixed32_field,json=fixed32Field,proto3" json:"fixed32_field,omitempty"`
+	Fixed64Field  uint64       `protobuf:"fixed64,10,opt,name=fixed64_field,json=fixed64Field,proto3" json:"fixed64_field,omitempty"`
+	Sfixed32Field int32        `protobuf:"fixed32,11,opt,name=sfixed32_field,json=sfixed32Field,proto3" json:"sfixed32_field,omitempty"`
+	Sfixed64Field int64        `protobuf:"fixed64,12,opt,name=sfixed64_field,json=sfixed64Field,proto3" json:"sfixed64_field,omitempty"`
+	BoolField     bool         `protobuf:"varint,13,opt,name=bool_field,json=boolField,proto3" json:"bool_field,omitempty"`
+	StringField   string       `protobuf:"bytes,14,opt,name=string_field,json=stringField,proto3" json:"string_field,omitempty"`
+	BytesField    []byte       `protobuf:"bytes,15,opt,name=bytes_field,json=bytesField,proto3" json:"bytes_field,omitempty"`
+	EnumField     Scalars_Enum `protobuf:"varint,16,opt,name=enum_field,json=enumField,proto3,enum=protoquery.Scalars_Enum" json:"enum_field,omitempty"`
+}
+
+func (x *Scalars) Reset() {
+	*x = Scalars{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_scalars_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Scalars) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Scalars) ProtoMessage() {}
+
+func (x *Scalars) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_scalars_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Scalars.ProtoReflect.Descriptor instead.
+func (*Scalars) Descriptor() ([]byte, []int) {
+	return file_proto_scalars_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Scalars) GetDoubleField() float64 {
+	if x != nil {
+		return x.DoubleField
+	}
+	return 0
+}
+
+func (x *Scalars) GetFloatField() float32 {
+	if x != nil {
+		return x.FloatField
+	}
+	return 0
+}
+
+func (x *Scalars) GetInt32Field() int32 {
+	if x != nil {
+		return x.Int32Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetInt64Field() int64 {
+	if x != nil {
+		return x.Int64Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetUint32Field() uint32 {
+	if x != nil {
+		return x.Uint32Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetUint64Field() uint64 {
+	if x != nil {
+		return x.Uint64Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetSint32Field() int32 {
+	if x != nil {
+		return x.Sint32Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetSint64Field() int64 {
+	if x != nil {
+		return x.Sint64Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetFixed32Field() uint32 {
+	if x != nil {
+		return x.Fixed32Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetFixed64Field() uint64 {
+	if x != nil {
+		return x.Fixed64Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetSfixed32Field() int32 {
+	if x != nil {
+		return x.Sfixed32Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetSfixed64Field() int64 {
+	if x != nil {
+		return x.Sfixed64Field
+	}
+	return 0
+}
+
+func (x *Scalars) GetBoolField() bool {
+	if x != nil {
+		return x.BoolField
+	}
+	return false
+}
+
+func (x *Scalars) GetStringField() string {
+	if x != nil {
+		return x.StringField
+	}
+	return ""
+}
+
+func (x *Scalars) GetBytesField() []byte {
+	if x != nil {
+		return x.BytesField
+	}
+	return nil
+}
+
+func (x *Scalars) GetEnumField() Scalars_Enum {
+	if x != nil {
+		return x.EnumField
+	}
+	return Scalars_ENUM_UNSPECIFIED
+}
+
+var File_proto_scalars_proto protoreflect.FileDescriptor
+
+var file_proto_scalars_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x63, 0x61, 0x6c, 0x61, 0x72, 0x73, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0a, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x71, 0x75, 0x65, 0x72,
+	0x79, 0x22, 0x3a, 0x0a, 0x0d, 0x53, 0x63, 0x61, 0x6c, 0x61, 0x72, 0x73, 0x48, 0x6f, 0x6c, 0x64,
+	0x65, 0x72, 0x12, 0x29, 0x0a, 0x05, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x13, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x53,
+	0x63, 0x61, 0x6c, 0x61, 0x72, 0x73, 0x52, 0x05, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x22, 0xfb, 0x04,
+	0x0a, 0x07, 0x53, 0x63, 0x61, 0x6c, 0x61, 0x72, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x64, 0x6f, 0x75,
+	0x62, 0x6c, 0x65, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x0b, 0x64, 0x6f, 0x75, 0x62, 0x6c, 0x65, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1f, 0x0a, 0x0b,
+	0x66, 0x6c, 0x6f, 0x61, 0x74, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x02, 0x52, 0x0a, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1f, 0x0a,
+	0x0b, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0a, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1f,
+	0x0a, 0x0b, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x0a, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12,
+	0x21, 0x0a, 0x0c, 0x75, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x75, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x46, 0x69, 0x65,
+	0x6c, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x75, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x5f, 0x66, 0x69, 0x65,
+	0x6c, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x75, 0x69, 0x6e, 0x74, 0x36, 0x34,
+	0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x5f,
+	0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x11, 0x52, 0x0b, 0x73, 0x69, 0x6e,
+	0x74, 0x33, 0x32, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x69, 0x6e, 0x74,
+	0x36, 0x34, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x12, 0x52, 0x0b,
+	0x73, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x66,
+	0x69, 0x78, 0x65, 0x64, 0x33, 0x32, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x07, 0x52, 0x0c, 0x66, 0x69, 0x78, 0x65, 0x64, 0x33, 0x32, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x12, 0x23, 0x0a, 0x0d, 0x66, 0x69, 0x78, 0x65, 0x64, 0x36, 0x34, 0x5f, 0x66, 0x69, 0x65, 0x6c,
+	0x64, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x06, 0x52, 0x0c, 0x66, 0x69, 0x78, 0x65, 0x64, 0x36, 0x34,
+	0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x25, 0x0a, 0x0e, 0x73, 0x66, 0x69, 0x78, 0x65, 0x64, 0x33,
+	0x32, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0f, 0x52, 0x0d, 0x73,
+	0x66, 0x69, 0x78, 0x65, 0x64, 0x33, 0x32, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x25, 0x0a, 0x0e,
+	0x73, 0x66, 0x69, 0x78, 0x65, 0x64, 0x36, 0x34, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x0c,
+	0x20, 0x01, 0x28, 0x10, 0x52, 0x0d, 0x73, 0x66, 0x69, 0x78, 0x65, 0x64, 0x36, 0x34, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x6f, 0x6f, 0x6c, 0x5f, 0x66, 0x69, 0x65, 0x6c,
+	0x64, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x62, 0x6f, 0x6f, 0x6c, 0x46, 0x69, 0x65,
+	0x6c, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x5f, 0x66, 0x69, 0x65,
+	0x6c, 0x64, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67,
+	0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x62, 0x79, 0x74, 0x65, 0x73, 0x5f, 0x66,
+	0x69, 0x65, 0x6c, 0x64, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x62, 0x79, 0x74, 0x65,
+	0x73, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x37, 0x0a, 0x0a, 0x65, 0x6e, 0x75, 0x6d, 0x5f, 0x66,
+	0x69, 0x65, 0x6c, 0x64, 0x18, 0x10, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2e, 0x53, 0x63, 0x61, 0x6c, 0x61, 0x72, 0x73, 0x2e,
+	0x45, 0x6e, 0x75, 0x6d, 0x52, 0x09, 0x65, 0x6e, 0x75, 0x6d, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x22,
+	0x2a, 0x0a, 0x04, 0x45, 0x6e, 0x75, 0x6d, 0x12, 0x14, 0x0a, 0x10, 0x45, 0x4e, 0x55, 0x4d, 0x5f,
+	0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0c, 0x0a,
+	0x08, 0x45, 0x4e, 0x55, 0x4d, 0x5f, 0x4f, 0x4e, 0x45, 0x10, 0x01, 0x42, 0x23, 0x5a, 0x21, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x73, 0x64, 0x72, 0x76, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_scalars_proto_rawDescOnce sync.Once
+	file_proto_scalars_proto_rawDescData = file_proto_scalars_proto_rawDesc
+)
+
+func file_proto_scalars_proto_rawDescGZIP() []byte {
+	file_proto_scalars_proto_rawDescOnce.Do(func() {
+		file_proto_scalars_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_scalars_proto_rawDescData)
+	})
+	return file_proto_scalars_proto_rawDescData
+}
+
+var file_proto_scalars_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_scalars_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_scalars_proto_goTypes = []interface{}{
+	(Scalars_Enum)(0),     // 0: protoquery.Scalars.Enum
+	(*ScalarsHolder)(nil), // 1: protoquery.ScalarsHolder
+	(*Scalars)(nil),       // 2: protoquery.Scalars
+}
+var file_proto_scalars_proto_depIdxs = []int32{
+	2, // 0: protoquery.ScalarsHolder.items:type_name -> protoquery.Scalars
+	0, // 1: protoquery.Scalars.enum_field:type_name -> protoquery.Scalars.Enum
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_scalars_proto_init() }
+func file_proto_scalars_proto_init() {
+	if File_proto_scalars_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_proto_scalars_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScalarsHolder); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_scalars_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Scalars); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_scalars_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_scalars_proto_goTypes,
+		DependencyIndexes: file_proto_scalars_proto_depIdxs,
+		EnumInfos:         file_proto_scalars_proto_enumTypes,
+		MessageInfos:      file_proto_scalars_proto_msgTypes,
+	}.Build()
+	File_proto_scalars_proto = out.File
+	file_proto_scalars_proto_rawDesc = nil
+	file_proto_scalars_proto_goTypes = nil
+	file_proto_scalars_proto_depIdxs = nil
+}
@@ -0,0 +1,333 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.1
+// 	protoc        v5.27.0
+// source: proto/wrappers.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ProfilesHolder holds messages with a field of every wrapper type.
+type ProfilesHolder struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Profiles []*Profile `protobuf:"bytes,1,rep,name=profiles,proto3" json:"profiles,omitempty"`
+}
+
+func (x *ProfilesHolder) Reset() {
+	*x = ProfilesHolder{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_wrappers_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProfilesHolder) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProfilesHolder) ProtoMessage() {}
+
+func (x *ProfilesHolder) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_wrappers_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProfilesHolder.ProtoReflect.Descriptor instead.
+func (*ProfilesHolder) Descriptor() ([]byte, []int) {
+	return file_proto_wrappers_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ProfilesHolder) GetProfiles() []*Profile {
+	if x != nil {
+		return x.Profiles
+	}
+	return nil
+}
+
+type Profile struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string                  `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Nickname  *wrapperspb.StringValue `protobuf:"bytes,2,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Verified  *wrapperspb.BoolValue   `protobuf:"bytes,3,opt,name=verified,proto3" json:"verified,omitempty"`
+	Age       *wrapperspb.Int32Value  `protobuf:"bytes,4,opt,name=age,proto3" json:"age,omitempty"`
+	Karma     *wrapperspb.Int64Value  `protobuf:"bytes,5,opt,name=karma,proto3" json:"karma,omitempty"`
+	Visits    *wrapperspb.UInt32Value `protobuf:"bytes,6,opt,name=visits,proto3" json:"visits,omitempty"`
+	Followers *wrapperspb.UInt64Value `protobuf:"bytes,7,opt,name=followers,proto3" json:"followers,omitempty"`
+	Score     *wrapperspb.FloatValue  `protobuf:"bytes,8,opt,name=score,proto3" json:"score,omitempty"`
+	Rating    *wrapperspb.DoubleValue `protobuf:"bytes,9,opt,name=rating,proto3" json:"rating,omitempty"`
+	Avatar    *wrapperspb.BytesValue  `protobuf:"bytes,10,opt,name=avatar,proto3" json:"avatar,omitempty"`
+}
+
+func (x *Profile) Reset() {
+	*x = Profile{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_wrappers_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Profile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Profile) ProtoMessage() {}
+
+func (x *Profile) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_wrappers_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Profile.ProtoReflect.Descriptor instead.
+func (*Profile) Descriptor() ([]byte, []int) {
+	return file_proto_wrappers_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Profile) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Profile) GetNickname() *wrapperspb.StringValue {
+	if x != nil {
+		return x.Nickname
+	}
+	return nil
+}
+
+func (x *Profile) GetVerified() *wrapperspb.BoolValue {
+	if x != nil {
+		return x.Verified
+	}
+	return nil
+}
+
+func (x *Profile) GetAge() *wrapperspb.Int32Value {
+	if x != nil {
+		return x.Age
+	}
+	return nil
+}
+
+func (x *Profile) GetKarma() *wrapperspb.Int64Value {
+	if x != nil {
+		return x.Karma
+	}
+	return nil
+}
+
+func (x *Profile) GetVisits() *wrapperspb.UInt32Value {
+	if x != nil {
+		return x.Visits
+	}
+	return nil
+}
+
+func (x *Profile) GetFollowers() *wrapperspb.UInt64Value {
+	if x != nil {
+		return x.Followers
+	}
+	return nil
+}
+
+func (x *Profile) GetScore() *wrapperspb.FloatValue {
+	if x != nil {
+		return x.Score
+	}
+	return nil
+}
+
+func (x *Profile) GetRating() *wrapperspb.DoubleValue {
+	if x != nil {
+		return x.Rating
+	}
+	return nil
+}
+
+func (x *Profile) GetAvatar() *wrapperspb.BytesValue {
+	if x != nil {
+		return x.Avatar
+	}
+	return nil
+}
+
+var File_proto_wrappers_proto protoreflect.FileDescriptor
+
+var file_proto_wrappers_proto_rawDesc = []byte{
+	0x0a, 0x14, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x77, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x73,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0a, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x71, 0x75, 0x65,
+	0x72, 0x79, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2f, 0x77, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x73, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0x41, 0x0a, 0x0e, 0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x48, 0x6f,
+	0x6c, 0x64, 0x65, 0x72, 0x12, 0x2f, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x71, 0x75,
+	0x65, 0x72, 0x79, 0x2e, 0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x52, 0x08, 0x70, 0x72, 0x6f,
+	0x66, 0x69, 0x6c, 0x65, 0x73, 0x22, 0x81, 0x04, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x38, 0x0a, 0x08, 0x6e, 0x69, 0x63, 0x6b, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67,
+	0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x08, 0x6e, 0x69, 0x63, 0x6b, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x36, 0x0a, 0x08, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x42, 0x6f, 0x6f, 0x6c, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x08, 0x76,
+	0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x12, 0x2d, 0x0a, 0x03, 0x61, 0x67, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x49, 0x6e, 0x74, 0x33, 0x32, 0x56, 0x61, 0x6c, 0x75,
+	0x65, 0x52, 0x03, 0x61, 0x67, 0x65, 0x12, 0x31, 0x0a, 0x05, 0x6b, 0x61, 0x72, 0x6d, 0x61, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x49, 0x6e, 0x74, 0x36, 0x34, 0x56, 0x61, 0x6c,
+	0x75, 0x65, 0x52, 0x05, 0x6b, 0x61, 0x72, 0x6d, 0x61, 0x12, 0x34, 0x0a, 0x06, 0x76, 0x69, 0x73,
+	0x69, 0x74, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x55, 0x49, 0x6e, 0x74,
+	0x33, 0x32, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x06, 0x76, 0x69, 0x73, 0x69, 0x74, 0x73, 0x12,
+	0x3a, 0x0a, 0x09, 0x66, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x72, 0x73, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x55, 0x49, 0x6e, 0x74, 0x36, 0x34, 0x56, 0x61, 0x6c, 0x75, 0x65,
+	0x52, 0x09, 0x66, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x72, 0x73, 0x12, 0x31, 0x0a, 0x05, 0x73,
+	0x63, 0x6f, 0x72, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x6c, 0x6f,
+	0x61, 0x74, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x34,
+	0x0a, 0x06, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x44, 0x6f, 0x75, 0x62, 0x6c, 0x65, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x06, 0x72, 0x61,
+	0x74, 0x69, 0x6e, 0x67, 0x12, 0x33, 0x0a, 0x06, 0x61, 0x76, 0x61, 0x74, 0x61, 0x72, 0x18, 0x0a,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x42, 0x79, 0x74, 0x65, 0x73, 0x56, 0x61, 0x6c, 0x75,
+	0x65, 0x52, 0x06, 0x61, 0x76, 0x61, 0x74, 0x61, 0x72, 0x42, 0x23, 0x5a, 0x21, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x73, 0x64, 0x72, 0x76, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_wrappers_proto_rawDescOnce sync.Once
+	file_proto_wrappers_proto_rawDescData = file_proto_wrappers_proto_rawDesc
+)
+
+func file_proto_wrappers_proto_rawDescGZIP() []byte {
+	file_proto_wrappers_proto_rawDescOnce.Do(func() {
+		file_proto_wrappers_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_wrappers_proto_rawDescData)
+	})
+	return file_proto_wrappers_proto_rawDescData
+}
+
+var file_proto_wrappers_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_wrappers_proto_goTypes = []interface{}{
+	(*ProfilesHolder)(nil),         // 0: protoquery.ProfilesHolder
+	(*Profile)(nil),                // 1: protoquery.Profile
+	(*wrapperspb.StringValue)(nil), // 2: google.protobuf.StringValue
+	(*wrapperspb.BoolValue)(nil),   // 3: google.protobuf.BoolValue
+	(*wrapperspb.Int32Value)(nil),  // 4: google.protobuf.Int32Value
+	(*wrapperspb.Int64Value)(nil),  // 5: google.protobuf.Int64Value
+	(*wrapperspb.UInt32Value)(nil), // 6: google.protobuf.UInt32Value
+	(*wrapperspb.UInt64Value)(nil), // 7: google.protobuf.UInt64Value
+	(*wrapperspb.FloatValue)(nil),  // 8: google.protobuf.FloatValue
+	(*wrapperspb.DoubleValue)(nil), // 9: google.protobuf.DoubleValue
+	(*wrapperspb.BytesValue)(nil),  // 10: google.protobuf.BytesValue
+}
+var file_proto_wrappers_proto_depIdxs = []int32{
+	1,  // 0: protoquery.ProfilesHolder.profiles:type_name -> protoquery.Profile
+	2,  // 1: protoquery.Profile.nickname:type_name -> google.protobuf.StringValue
+	3,  // 2: protoquery.Profile.verified:type_name -> google.protobuf.BoolValue
+	4,  // 3: protoquery.Profile.age:type_name -> google.protobuf.Int32Value
+	5,  // 4: protoquery.Profile.karma:type_name -> google.protobuf.Int64Value
+	6,  // 5: protoquery.Profile.visits:type_name -> google.protobuf.UInt32Value
+	7,  // 6: protoquery.Profile.followers:type_name -> google.protobuf.UInt64Value
+	8,  // 7: protoquery.Profile.score:type_name -> google.protobuf.FloatValue
+	9,  // 8: protoquery.Profile.rating:type_name -> google.protobuf.DoubleValue
+	10, // 9: protoquery.Profile.avatar:type_name -> google.protobuf.BytesValue
+	10, // [10:10] is the sub-list for method output_type
+	10, // [10:10] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_proto_wrappers_proto_init() }
+func file_proto_wrappers_proto_init() {
+	if File_proto_wrappers_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_proto_wrappers_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProfilesHolder); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_wrappers_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Profile); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_wrappers_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_wrappers_proto_goTypes,
+		DependencyIndexes: file_proto_wrappers_proto_depIdxs,
+		MessageInfos:      file_proto_wrappers_proto_msgTypes,
+	}.Build()
+	File_proto_wrappers_proto = out.File
+	file_proto_wrappers_proto_rawDesc = nil
+	file_proto_wrappers_proto_goTypes = nil
+	file_proto_wrappers_proto_depIdxs = nil
+}
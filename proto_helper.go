@@ -13,12 +13,16 @@ func enumStr(fd protoreflect.FieldDescriptor, v protoreflect.Value) (string, boo
 }
 
 // stripProto returns the underlying Go value of the protoreflect.Value.
+// The wrapper messages, e.g.: google.protobuf.StringValue, are unwrapped.
 func stripProto(v protoreflect.Value) any {
 	if !v.IsValid() {
 		return nil
 	}
 	switch v.Interface().(type) {
 	case protoreflect.Message:
+		if wv, ok := wrappedValue(v.Message()); ok {
+			return wv.Interface()
+		}
 		return v.Message().Interface()
 	default:
 		return v.Interface()
@@ -50,22 +54,11 @@ func canRecurse(v protoreflect.Value) bool {
 	return false
 }
 
-// flat return a flat list of value(s). If the value is a message, it returns a list with the only element.
-// If the value is a list, it its elements.
-// The function performs validity check on the value.
-func flat(v protoreflect.Value) []protoreflect.Value {
-	res := []protoreflect.Value{}
-	if isList(v) {
-		for i := 0; i < v.List().Len(); i++ {
-			if vv := v.List().Get(i); vv.IsValid() {
-				res = append(res, v.List().Get(i))
-			}
-		}
-	} else {
-		if v.IsValid() {
-			res = append(res, v)
-		}
+// originIndex returns the index of the i-th list element in the original list.
+// Temporary lists keep track of the original element indices.
+func originIndex(list protoreflect.List, i int) int {
+	if tl, ok := list.(*TmpList); ok {
+		return tl.Origin(i)
 	}
-
-	return res
+	return i
 }
@@ -1,6 +1,10 @@
 package protoquery
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
 	"os"
 	"reflect"
 
@@ -9,7 +13,31 @@ import (
 )
 
 type ProtoQuery struct {
-	query Query
+	tree *QueryTree
+	// expr is set instead of tree if the query top level is an expression,
+	// e.g.: `count(/people)` (see Evaluate).
+	expr Expression
+	// md is the root message descriptor the query is bound to (see CompileFor).
+	md protoreflect.MessageDescriptor
+	// oneBased indicates XPath-compatible 1-based positions (see WithXPathPositions).
+	oneBased bool
+	// funcs is the set of the query-specific functions (see WithFunctions).
+	funcs *FunctionSet
+	// vars are the names of the variables the query refers to (see Bind).
+	vars []string
+}
+
+// CompileOption configures the query compilation.
+type CompileOption func(*ProtoQuery)
+
+// WithXPathPositions switches the query to XPath 1-based positions: the first
+// list element is at position 1. It affects the positional functions
+// (position(), first(), last()) and the list indices, e.g.: `/people[1]` is
+// the first person and `/people[last()]` is the last one.
+func WithXPathPositions() CompileOption {
+	return func(pq *ProtoQuery) {
+		pq.oneBased = true
+	}
 }
 
 type qmemkey struct {
@@ -22,6 +50,83 @@ type queueItem struct {
 	qix   int
 	ptr   protoreflect.Value
 	descr protoreflect.FieldDescriptor
+	// parent is the queue item of the message containing ptr.
+	parent *queueItem
+	// path is the location of ptr in the root message.
+	path *pathElem
+	// depth is the message nesting depth of ptr.
+	depth int
+}
+
+// next returns a copy of the item advanced to the next query step.
+func (qi queueItem) next() queueItem {
+	qi.qix++
+	return qi
+}
+
+// field returns an item pointing to the message field value.
+func (qi queueItem) field(qix int, fd protoreflect.FieldDescriptor, val protoreflect.Value) queueItem {
+	return queueItem{
+		qix:    qix,
+		ptr:    val,
+		descr:  fd,
+		parent: &qi,
+		path:   fieldPathElem(qi.path, fd),
+		depth:  qi.depth + 1,
+	}
+}
+
+// elem returns an item pointing to the list (or bytes) element.
+func (qi queueItem) elem(qix int, val protoreflect.Value, index int) queueItem {
+	return queueItem{
+		qix:    qix,
+		ptr:    val,
+		descr:  qi.descr,
+		parent: qi.parent,
+		path:   indexPathElem(qi.path, index),
+		depth:  qi.depth,
+	}
+}
+
+// slice returns an item pointing to the string or bytes slice.
+func (qi queueItem) slice(qix int, val protoreflect.Value, ix []int) queueItem {
+	qi.qix = qix
+	qi.ptr = val
+	qi.path = slicePathElem(qi.path, formatSlice(ix))
+	return qi
+}
+
+// entry returns an item pointing to the map value.
+func (qi queueItem) entry(qix int, val protoreflect.Value, key protoreflect.MapKey) queueItem {
+	var descr protoreflect.FieldDescriptor
+	if qi.descr != nil && qi.descr.IsMap() {
+		descr = qi.descr.MapValue()
+	}
+	return queueItem{
+		qix:    qix,
+		ptr:    val,
+		descr:  descr,
+		parent: qi.parent,
+		path:   keyPathElem(qi.path, key),
+		depth:  qi.depth,
+	}
+}
+
+// flat returns the items of the list elements if the item points to a list.
+// Otherwise it returns a list with the item itself.
+// The function performs validity check on the value.
+func (qi queueItem) flat() []queueItem {
+	res := []queueItem{}
+	if list, ok := toList(qi.ptr); ok {
+		for i := 0; i < list.Len(); i++ {
+			if v := list.Get(i); v.IsValid() {
+				res = append(res, qi.elem(qi.qix, v, originIndex(list, i)))
+			}
+		}
+	} else if qi.ptr.IsValid() {
+		res = append(res, qi)
+	}
+	return res
 }
 
 func (qi queueItem) Serialize() (qmemkey, bool) {
@@ -39,285 +144,228 @@ var (
 	DEBUG = os.Getenv("DEBUG") != ""
 )
 
-func Compile(q string) (*ProtoQuery, error) {
+func Compile(q string, opts ...CompileOption) (*ProtoQuery, error) {
 	tokens, err := tokenizeXPathQuery(q)
 	if err != nil {
 		return nil, err
 	}
-	query, err := compileQuery(tokens)
-	if err != nil {
+	pq := &ProtoQuery{}
+	if pq.tree, err = compileQueryTree(tokens); err != nil {
+		// A query that is not a path might be an expression.
+		expr, eerr := compileExpression(tokens)
+		if eerr != nil {
+			return nil, err
+		}
+		pq.expr = expr
+	}
+	for _, opt := range opts {
+		opt(pq)
+	}
+	if err := resolveFunctions(pq); err != nil {
 		return nil, err
 	}
-	return &ProtoQuery{query: query}, nil
+	pq.vars = queryVariables(pq)
+	return pq, nil
 }
 
-func (pq *ProtoQuery) FindAll(root proto.Message) []any {
-	if DEBUG {
-		debugf("Query: %s", pq.query)
+func (pq *ProtoQuery) String() string {
+	if pq.expr != nil {
+		return pq.expr.String()
 	}
+	return pq.tree.String()
+}
 
-	res := []any{}
-	if root == nil {
-		return res
+// compileExpression compiles a top-level expression query.
+func compileExpression(tokens []*Token) (Expression, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
 	}
+	expr, ix, err := parseExpression(tokens, 0, LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if ix < len(tokens) {
+		return nil, fmt.Errorf("unexpected token %v %q", tokens[ix].Kind, tokens[ix].Value)
+	}
+	return expr, nil
+}
 
-	queue := NewQueueOnce[qmemkey, queueItem]()
-	queue.Push(queueItem{
-		qix: 0,
-		ptr: protoreflect.ValueOf(root.ProtoReflect()),
-	})
+// Evaluate evaluates the query against the root message and returns the
+// result along with its type. Unlike FindAll, it supports queries whose top
+// level is an expression, e.g.: `count(/people)`,
+// `sum(/books/price) / count(/books)` or
+// `/people[0]/name + ' <' + /people[0]/email + '>'`.
+// Paths within the expression are evaluated relative to the root message.
+// The query variables are bound with the Bind option.
+// A path query evaluates to a NodeSet. The result is nil if the expression
+// refers to unset values. Unlike FindAll, the evaluation is strict unless
+// WithStrict(false) is given: the errors of the embedded paths are reported.
+func (pq *ProtoQuery) Evaluate(root proto.Message, opts ...FindOption) (any, Type, error) {
+	return pq.EvaluateContext(context.Background(), root, opts...)
+}
 
-	var head queueItem
-	for queue.Len() > 0 {
-		head = queue.Pop()
-		// We've reached the end of the query, so we can append the current pointer to the result.
-		if head.qix >= len(pq.query) {
-			for _, v := range flat(head.ptr) {
-				res = append(res, stripProto(v))
-			}
-			continue
-		}
-		step := pq.query[head.qix]
-		if DEBUG {
-			debugf("-> current pointer: %s", printProtoVal(head.ptr))
-			debugf("~> step: %s", step)
-		}
-		switch step.Kind() {
-		case RootQueryStepKind:
-			debugf("Root step: %s", step)
-			queue.Push(queueItem{
-				qix:   head.qix + 1,
-				ptr:   head.ptr,
-				descr: head.descr,
-			})
-		case NodeQueryStepKind:
-			debugf("Node step: %s", step)
-			for _, c := range flat(head.ptr) {
-				if msg, ok := toMessage(c); ok {
-					for _, fd := range matchMsgFields(msg, step.(*NodeQueryStep).name) {
-						val := msg.Get(fd)
-						if fd.Kind() == protoreflect.EnumKind {
-							if e, ok := enumStr(fd, val); ok {
-								val = protoreflect.ValueOfString(e)
-							}
-						}
-						queue.Push(queueItem{
-							qix:   head.qix + 1,
-							ptr:   val,
-							descr: fd,
-						})
-					}
-				} else {
-					debugf("Node step: %s: not a message, skipping", step)
-				}
-			}
-		case KeyQueryStepKind:
-			debugf("KeyQuery step: %s", step)
-			ks := step.(*KeyQueryStep)
-			if list, ok := toList(head.ptr); ok {
-				// TODO(osdrv): we can pre-compute isAllPropertyExprs as a property
-				// of the query, rather than doing it on the go.
-				// isAllPropertyExprs would check if the key only consists of
-				// attribute properties. I.e. it only checks if these properties
-				// are present in the message.
-				// E.g. [@foo && @bar && @baz]
-				enforceBool := isAllPropertyExprs(ks.expr)
-				ctx := NewEvalContext(list, WithEnforceBool(enforceBool))
-				typ, err := ks.expr.Type(ctx)
-				if err != nil {
-					debugf("keyStep.Type(list) returned an error: %s", err)
-					continue
-				}
-				switch typ {
-				// Grep mode
-				case TypeBool:
-					// 1. Initialize a new list to store the intermediate results.
-					// 2. The list should have the same signature as the original list.
-					// 3. Populate the new list with the matching elements.
-					// 4. Append the new list to the queue.
-					tl := NewTmpList(head.descr)
-					for i := 0; i < list.Len(); i++ {
-						ctxel := NewIndexedEvalContext(
-							list.Get(i).Interface(),
-							i,
-							WithEnforceBool(enforceBool),
-						)
-						v, err := ks.expr.Eval(ctxel)
-						if err != nil {
-							debugf("keyStep.Eval(list):bool returned an error on Eval: %s", err)
-							continue
-						}
-						if pick, err := toBool(v); err != nil {
-							debugf("keyStep.Eval(list):bool returned an error on toBool: %s", err)
-							continue
-						} else if pick {
-							tl.Append(list.Get(i))
-						}
-					}
-					if tl.Len() > 0 {
-						queue.Push(queueItem{
-							qix:   head.qix + 1,
-							ptr:   protoreflect.ValueOf(tl),
-							descr: head.descr, // The type descriptor won't change: lists have identical signatures.
-						})
-					}
-				// Index mode
-				case TypeInt:
-					v, err := ks.expr.Eval(ctx)
-					if err != nil {
-						debugf("keyStep.Eval(list):int returned an error on Eval: %s", err)
-						continue
-					}
-					ix, err := toInt64(v)
-					if err != nil {
-						debugf("keyStep.Eval(list):int returned an error on toInt64: %s", err)
-						continue
-					}
-					if ix >= 0 && ix < int64(list.Len()) {
-						queue.Push(queueItem{
-							qix: head.qix + 1,
-							ptr: list.Get(int(ix)),
-							// TODO(osdrv): type descriptor
-						})
-					}
-				default:
-					debugf("keyStep.Type(list) returned an unsupported type: %s", typ)
-					continue
-				}
-			} else if mp, ok := toMap(head.ptr); ok {
-				ctx := NewEvalContext(mp)
-				k, err := ks.expr.Eval(ctx)
-				if err != nil {
-					debugf("keyStep.Eval(map) returned an error: %s", err)
-					continue
-				}
-				if head.descr == nil {
-					debugf("No information about map key type, trying the raw value")
-				} else {
-					if fd := head.descr; fd == nil || !fd.IsMap() {
-						debugf("Unexpected descriptor kind: want protoreflect.Map, got %v", head.descr.Kind())
-						continue
-					}
-					var ok bool
-					keyKind := head.descr.MapKey().Kind()
-					k, ok = castToProtoreflectKind(k, keyKind)
-					if !ok {
-						debugf("Can not cast value %+v to protoreflect.Kind=%v", k, keyKind)
-						continue
-					}
-				}
-				exprval := protoreflect.ValueOf(k)
-				key := exprval.MapKey()
-				if mp.Has(key) {
-					queue.Push(queueItem{
-						qix:   head.qix + 1,
-						ptr:   mp.Get(key),
-						descr: head.descr.MapValue(),
-					})
-				}
-			} else if bytes, ok := toBytes(head.ptr); ok {
-				ctx := NewEvalContext(head.ptr)
-				typ, err := ks.expr.Type(ctx)
-				if err != nil {
-					debugf("keyStep.Type(bytes) returned an error: %s", err)
-					continue
-				}
-				if typ != TypeInt {
-					debugf("keyStep.Type(bytes) returned an unsupported type: %s", typ)
-					continue
-				}
-				k, err := ks.expr.Eval(ctx)
-				if err != nil {
-					debugf("keyStep.Eval(bytes) returned an error: %s", err)
-					continue
-				}
-				ix, err := toInt64(k)
-				if err != nil {
-					debugf("keyStep.Eval(bytes) returned an error on toInt64: %s", err)
-					continue
-				}
-				if ix >= 0 && int(ix) < len(bytes) {
-					queue.Push(queueItem{
-						qix: head.qix + 1,
-						// protoreflect does not support any ints below 32bits, hence the type casting
-						ptr: protoreflect.ValueOf(uint32(bytes[ix])),
-						// TODO(osdrv): type descriptor
-					})
-				}
-			} else if msg, ok := toMessage(head.ptr); ok {
-				// We always enforce bool context on a message.
-				ctx := NewEvalContext(msg)
-				v, err := ks.expr.Eval(ctx)
-				if err != nil {
-					debugf("keyStep.Eval(message) returned an error: %s", err)
-					continue
-				}
-				pick, err := toBool(v)
-				if err != nil {
-					debugf("keyStep.Eval(message) returned an error on toBool: %s", err)
-					continue
-				}
-				if pick {
-					queue.Push(queueItem{
-						qix:   head.qix + 1,
-						ptr:   head.ptr,
-						descr: head.descr,
-					})
-				}
-			} else {
-				debugf("Current pointer: %s", printProtoVal(head.ptr))
-				debugf("Key step: %s", step)
-				panic("TODO(osdrv): not implemented")
-			}
-		case RecursiveDescentQueryStepKind:
-			debugf("Recursive descent step: %s", step)
-			if msg, ok := toMessage(head.ptr); ok {
-				// test the message itself
-				queue.Push(queueItem{
-					qix:   head.qix + 1,
-					ptr:   head.ptr,
-					descr: head.descr,
-				})
-				// recurse over all the fields
-				for _, fd := range matchMsgFields(msg, "*") {
-					if canRecurse(msg.Get(fd)) {
-						// preserve the recursive descent query step
-						queue.Push(queueItem{
-							qix:   head.qix,
-							ptr:   msg.Get(fd),
-							descr: fd,
-						})
-					}
-				}
-			} else if list, ok := toList(head.ptr); ok {
-				for i := 0; i < list.Len(); i++ {
-					if canRecurse(list.Get(i)) {
-						// preserve the recursive descent query step
-						queue.Push(queueItem{
-							qix:   head.qix,
-							ptr:   list.Get(i),
-							descr: head.descr,
-						})
-					}
-				}
-			} else if mp, ok := toMap(head.ptr); ok {
-				mp.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
-					if canRecurse(value) {
-						// preserve the recursive descent query step
-						queue.Push(queueItem{
-							qix:   head.qix,
-							ptr:   value,
-							descr: head.descr.MapValue(),
-						})
-					}
-					return true
-				})
-			} else {
-				debugf("RecursiveDescentQuery is not implemented for %+v", head.ptr.Interface())
-			}
-		default:
-			panicf("Query step %q(kind=%v) is not supported", step.String(), step.Kind())
+// EvaluateContext is similar to Evaluate, but it terminates the evaluation
+// with the context error as soon as the context is done (see FindAllContext).
+func (pq *ProtoQuery) EvaluateContext(ctx context.Context, root proto.Message, opts ...FindOption) (any, Type, error) {
+	if root == nil {
+		return nil, TypeUnknown, nil
+	}
+	// Like path queries, expression queries report the errors of the
+	// embedded paths by default.
+	opts = append([]FindOption{WithStrict(true)}, opts...)
+	if pq.expr == nil {
+		res := NodeSet{}
+		err := pq.walk(ctx, root, func(qi queueItem) bool {
+			res = append(res, Node{item: qi})
+			return true
+		}, opts...)
+		if err != nil {
+			return nil, TypeUnknown, err
 		}
+		return res, TypeNodeSet, nil
+	}
+	if err := pq.checkRoot(root); err != nil {
+		return nil, TypeUnknown, err
+	}
+	fopts := &findOptions{oneBased: pq.oneBased}
+	for _, opt := range opts {
+		opt(fopts)
+	}
+	if err := fopts.prepare(pq.vars); err != nil {
+		return nil, TypeUnknown, err
+	}
+	msg := root.ProtoReflect()
+	ev := newEvaluator(ctx, nil, fopts, msg)
+	ectx := NewEvalContext(msg, ev.evalOptions(rootItem(msg))...)
+	typ, err := pq.expr.Type(ectx)
+	if err != nil {
+		return nil, TypeUnknown, err
+	}
+	v, err := pq.expr.Eval(ectx)
+	if errors.Is(err, PropNotSet) {
+		return nil, typ, nil
+	} else if err != nil {
+		return nil, TypeUnknown, err
+	}
+	if ns, ok := v.(NodeSet); ok {
+		return ns, TypeNodeSet, nil
+	}
+	// The static type of an operation over node sets is not known upfront.
+	if sv, styp, ok := scalarValue(v); ok {
+		return sv, styp, nil
+	}
+	return v, typ, nil
+}
+
+// FindAll returns all the values matching the query. The query variables
+// are bound with the Bind option.
+// The values of a query combining paths with the set operators (`|`,
+// `intersect`, `except`) are deduplicated and returned in the document order.
+// The evaluation errors are not reported, use FindAllE or FindAllContext to
+// get them. An unbound query variable is a programming error: FindAll panics.
+func (pq *ProtoQuery) FindAll(root proto.Message, opts ...FindOption) []any {
+	res := []any{}
+	pq.walkAll(root, func(qi queueItem) bool {
+		res = append(res, stripProto(qi.ptr))
+		return true
+	}, opts...)
+	return res
+}
+
+// FindAllE is similar to FindAll but it reports the evaluation errors.
+// In strict mode (see WithStrict) the evaluation terminates on the first error
+// and the error is returned as *EvalError. Otherwise the evaluation carries on
+// and the errors could be collected as warnings (see WithWarnings).
+func (pq *ProtoQuery) FindAllE(root proto.Message, opts ...FindOption) ([]any, error) {
+	return pq.FindAllContext(context.Background(), root, opts...)
+}
+
+// FindAllContext is similar to FindAllE, but it terminates the evaluation
+// with the context error as soon as the context is done. Use it together with
+// the resource limit options (WithMaxResults, WithMaxVisitedNodes, WithMaxDepth,
+// WithMaxQueueMemory) to bound the evaluation of untrusted queries.
+func (pq *ProtoQuery) FindAllContext(ctx context.Context, root proto.Message, opts ...FindOption) ([]any, error) {
+	res := []any{}
+	err := pq.walk(ctx, root, func(qi queueItem) bool {
+		res = append(res, stripProto(qi.ptr))
+		return true
+	}, opts...)
+	if err != nil {
+		return nil, err
 	}
+	return res, nil
+}
+
+// FindNodes returns all the nodes matching the query. Unlike FindAll, every node
+// carries the location of the value in the root message. Like FindAll, it
+// panics if a query variable is not bound.
+func (pq *ProtoQuery) FindNodes(root proto.Message, opts ...FindOption) []Node {
+	res := []Node{}
+	pq.walkAll(root, func(qi queueItem) bool {
+		res = append(res, Node{item: qi})
+		return true
+	}, opts...)
 	return res
 }
+
+// FindFirst returns the first value matching the query. The traversal stops
+// as soon as the first match is found. Like FindAll, it panics if a query
+// variable is not bound.
+func (pq *ProtoQuery) FindFirst(root proto.Message, opts ...FindOption) (any, bool) {
+	var res any
+	found := false
+	pq.walkAll(root, func(qi queueItem) bool {
+		res = stripProto(qi.ptr)
+		found = true
+		return false
+	}, opts...)
+	return res, found
+}
+
+// Exists returns true if the query matches at least one value. It panics if
+// a query variable is not bound (see FindFirst).
+func (pq *ProtoQuery) Exists(root proto.Message, opts ...FindOption) bool {
+	_, found := pq.FindFirst(root, opts...)
+	return found
+}
+
+// Count returns the number of values matching the query. Unlike FindAll,
+// it does not materialize the result, but it panics alike if a query
+// variable is not bound.
+func (pq *ProtoQuery) Count(root proto.Message, opts ...FindOption) int {
+	cnt := 0
+	pq.walkAll(root, func(queueItem) bool {
+		cnt++
+		return true
+	}, opts...)
+	return cnt
+}
+
+// All returns an iterator over the values matching the query. The values are
+// yielded as soon as the traversal produces them, so breaking out of the loop
+// terminates the traversal. The iteration panics if a query variable is not
+// bound (see Walk).
+func (pq *ProtoQuery) All(root proto.Message, opts ...FindOption) iter.Seq[any] {
+	return func(yield func(any) bool) {
+		pq.Walk(root, yield, opts...)
+	}
+}
+
+// Walk calls fn on every value matching the query. The traversal terminates
+// as soon as fn returns false. Like FindAll, it does not report the
+// evaluation errors and it panics if a query variable is not bound.
+func (pq *ProtoQuery) Walk(root proto.Message, fn func(v any) bool, opts ...FindOption) {
+	pq.walkAll(root, func(qi queueItem) bool {
+		return fn(stripProto(qi.ptr))
+	}, opts...)
+}
+
+// walkAll is walk for the API which does not report the evaluation errors.
+// Unlike the evaluation errors, an unbound query variable does not depend on
+// the message: the query could never be evaluated, hence the panic.
+func (pq *ProtoQuery) walkAll(root proto.Message, yield func(queueItem) bool, opts ...FindOption) {
+	err := pq.walk(context.Background(), root, yield, opts...)
+	if errors.Is(err, ErrUnboundVariable) {
+		panic(err)
+	}
+}
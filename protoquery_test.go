@@ -1,9 +1,17 @@
 package protoquery
 
 import (
+	"context"
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/osdrv/protoquery/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestFindAllAttributeAccess(t *testing.T) {
@@ -287,6 +295,51 @@ func TestFindAllRepeatedScalars(t *testing.T) {
 			query: "/items/bytes[100]",
 			want:  []any{},
 		},
+		{
+			name:  "filter int32 repeated attribute by value",
+			query: "/items/int32s[. > 1]",
+			want:  []any{int32(2), int32(3)},
+		},
+		{
+			name:  "filter int64 repeated attribute by value",
+			query: "/items/int64s[. != 2]",
+			want:  []any{int64(1), int64(3)},
+		},
+		{
+			name:  "filter uint32 repeated attribute by value",
+			query: "/items/uint32s[. <= 2]",
+			want:  []any{uint32(1), uint32(2)},
+		},
+		{
+			name:  "filter uint64 repeated attribute by value",
+			query: "/items/uint64s[. = 3]",
+			want:  []any{uint64(3)},
+		},
+		{
+			name:  "filter float repeated attribute by value",
+			query: "/items/floats[. > 2]",
+			want:  []any{float32(2.2), float32(3.3)},
+		},
+		{
+			name:  "filter string repeated attribute by value",
+			query: "/items/strings[. = 'b']",
+			want:  []any{"b"},
+		},
+		{
+			name:  "filter bools repeated attribute by value",
+			query: "/items/bools[.]",
+			want:  []any{true},
+		},
+		{
+			name:  "filter by value and position",
+			query: "/items/int32s[(. > 1) && position() > 1]",
+			want:  []any{int32(3)},
+		},
+		{
+			name:  "self step",
+			query: "/items/./strings/.",
+			want:  []any{"a", "b", "c"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -464,6 +517,16 @@ func TestFindAllMapAccess(t *testing.T) {
 			query: "/messages_with_map/string_string_map[1]",
 			want:  []any{},
 		},
+		{
+			name:  "int32 key overflow",
+			query: "/messages_with_map/int32_inner_map[4294967419]/inner_string",
+			want:  []any{},
+		},
+		{
+			name:  "negative uint32 key",
+			query: "/messages_with_map/uint32_inner_map[-4294967173]/inner_string",
+			want:  []any{},
+		},
 		{
 			name:  "bool key lookup on a string-string map",
 			query: "/messages/with_map/string_string_map[true]",
@@ -486,54 +549,103 @@ func TestFindAllMapAccess(t *testing.T) {
 	}
 }
 
-func TestFindAllListBuiltins(t *testing.T) {
-	store := proto.Bookstore{
-		Books: []*proto.Book{
-			{
-				Title:  "The Go Programming Language",
-				Author: "Alan A. A. Donovan",
-				Price:  34.99,
-			},
-			{
-				Title:  "The Rust Programming Language",
-				Author: "Steve Klabnik",
-				Price:  39.99,
-			},
-			{
-				Title: "The Bible",
-				Price: 0.00,
-			},
+func TestFindAllTimestamps(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{Name: "Alice", LastUpdated: timestamppb.New(time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC))},
+			{Name: "John", LastUpdated: timestamppb.New(time.Date(2024, 3, 1, 12, 0, 0, 5e8, time.UTC))},
+			{Name: "Bob"},
+			{Name: "Carol", LastUpdated: timestamppb.New(time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC))},
 		},
 	}
+	clock := func() time.Time {
+		return time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+	}
+
 	tests := []struct {
-		name  string
-		query string
-		want  []any
+		name    string
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
 	}{
 		{
-			name:  "return the last element of the list",
-			query: "/books[length() - 1]",
-			want:  []any{store.Books[2]},
+			name:  "rfc 3339 literal",
+			query: "/people[@last_updated > '2024-01-01T00:00:00Z']/name",
+			want:  []any{"John", "Carol"},
 		},
 		{
-			name:  "out-of-bounds index with length",
-			query: "/books[length() - 100]",
-			want:  []any{},
+			name:  "fractional seconds",
+			query: "/people[@last_updated = '2024-03-01T12:00:00.5Z']/name",
+			want:  []any{"John"},
 		},
 		{
-			name:  "position in a boolean context",
-			query: "/books[position() <= 1]",
-			want:  []any{store.Books[0], store.Books[1]},
+			name:  "time zone offset",
+			query: "/people[@last_updated = '2024-01-01T00:00:00+01:00']/name",
+			want:  []any{"Alice"},
 		},
 		{
-			name:  "position with unexpected type",
-			query: "/books[position() > true]",
-			want:  []any{},
+			name:  "unset timestamp is not ordered",
+			query: "/people[@last_updated < '2024-01-01T00:00:00Z']/name",
+			want:  []any{"Alice"},
 		},
 		{
-			name:  "position with unexpected operand",
-			query: "/books[position() + 1]",
-			want:  []any{},
+			name:  "unset timestamp is null",
+			query: "/people[@last_updated != '2024-03-01T12:00:00.5Z']/name",
+			want:  []any{"Alice", "Carol"},
+		},
+		{
+			name:  "presence",
+			query: "/people[@last_updated]/name",
+			want:  []any{"Alice", "John", "Carol"},
+		},
+		{
+			name:  "elapsed time",
+			query: "/people[now() - @last_updated > '24h']/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "minutes literal",
+			query: "/people[now() - @last_updated <= '60m']/name",
+			want:  []any{"Carol"},
+		},
+		{
+			name:  "timestamp shifted by a duration",
+			query: "/people[@last_updated + '240h' > now()]/name",
+			want:  []any{"John", "Carol"},
+		},
+		{
+			name:  "sub-path comparison",
+			query: "/people[last_updated >= '2024-03-01T00:00:00Z']/name",
+			want:  []any{"John", "Carol"},
+		},
+		{
+			name:  "time variable",
+			query: "/people[@last_updated < $since]/name",
+			opts:  []FindOption{Bind("since", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))},
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "timestamp message variable",
+			query: "/people[@last_updated = $at]/name",
+			opts:  []FindOption{Bind("at", timestamppb.New(time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)))},
+			want:  []any{"Carol"},
+		},
+		{
+			name:  "duration variable",
+			query: "/people[now() - @last_updated < $ttl]/name",
+			opts:  []FindOption{Bind("ttl", 2*time.Hour)},
+			want:  []any{"Carol"},
+		},
+		{
+			name:    "invalid timestamp literal",
+			query:   "/people[@last_updated > 'yesterday']/name",
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "duration compared to a timestamp",
+			query:   "/people[now() - @last_updated > '2024-01-01T00:00:00Z']/name",
+			wantErr: ErrInvalidType,
 		},
 	}
 
@@ -541,93 +653,82 @@ func TestFindAllListBuiltins(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pq, err := Compile(tt.query)
 			if err != nil {
-				t.Errorf("Compile() error = %v, no error expected", err)
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(ab, append(tt.opts, WithClock(clock), WithStrict(true))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
 				return
 			}
-			res := pq.FindAll(&store)
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
 			if !deepEqual(res, tt.want) {
-				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
 			}
 		})
 	}
 }
 
-func TestFindAllEnum(t *testing.T) {
-	holder := &proto.MessageWithEnumHolder{
-		Messages: []*proto.MessageWithEnum{
-			{
-				EnumField:   proto.MessageWithEnum_ENUM1,
-				StringField: "message with enum1",
-			},
-			{
-				EnumField:   proto.MessageWithEnum_ENUM2,
-				StringField: "message with enum2",
-			},
-			{
-				EnumField:   proto.MessageWithEnum_ENUM3,
-				StringField: "message with enum3",
-			},
-			{
-				// Unset enum would be evaluated to the default int
-				// value which is 0. I.e. An unset enum is trivially
-				// equal to the first enum value.
-				StringField: "message with empty enum",
-			},
-		},
-		MessagesWithAlias: []*proto.MessageWithAllowAliasEnum{
-			{
-				EnumField:   proto.MessageWithAllowAliasEnum_ENUM1,
-				StringField: "message with enum1",
-			},
-			{
-				EnumField:   proto.MessageWithAllowAliasEnum_ENUM2,
-				StringField: "message with enum2",
-			},
-			{
-				EnumField:   proto.MessageWithAllowAliasEnum_ENUM3,
-				StringField: "message with enum3 (alias enum2)",
-			},
+func TestEvaluateTimes(t *testing.T) {
+	alice := time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC)
+	john := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{Name: "Alice", LastUpdated: timestamppb.New(alice)},
+			{Name: "John", LastUpdated: timestamppb.New(john)},
 		},
 	}
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+	reads := 0
+	clock := func() time.Time {
+		reads++
+		return now
+	}
+
 	tests := []struct {
-		name  string
-		query string
-		want  []any
+		name     string
+		query    string
+		want     any
+		wantType Type
 	}{
 		{
-			name:  "single enum selector",
-			query: "/messages[@enum_field = 'ENUM1']",
-			want:  []any{holder.Messages[0], holder.Messages[3]},
-		},
-		{
-			name:  "single enum selector",
-			query: "/messages[@enum_field = 'ENUM2']",
-			want:  []any{holder.Messages[1]},
+			name:     "now",
+			query:    "now()",
+			want:     now,
+			wantType: TypeTimestamp,
 		},
 		{
-			name:  "single enum selector",
-			query: "/messages[@enum_field = 'ENUM3']",
-			want:  []any{holder.Messages[2]},
+			name:     "the clock is read once",
+			query:    "now() - now()",
+			want:     time.Duration(0),
+			wantType: TypeDuration,
 		},
 		{
-			name:  "single enum selector with a non-existing enum value",
-			query: "/messages[@enum_field = 'ENUM4']",
-			want:  []any{},
+			name:     "elapsed time",
+			query:    "now() - /people[0]/last_updated",
+			want:     now.Sub(alice),
+			wantType: TypeDuration,
 		},
 		{
-			name:  "select enum values failing",
-			query: "/messages/enum_field",
-			want:  []any{"ENUM1", "ENUM2", "ENUM3", "ENUM1"},
+			name:     "difference of the timestamps",
+			query:    "/people[1]/last_updated - /people[0]/last_updated",
+			want:     john.Sub(alice),
+			wantType: TypeDuration,
 		},
 		{
-			name:  "select enum values with alias",
-			query: "/messages_with_alias[@enum_field = 'ENUM2']",
-			want:  []any{holder.MessagesWithAlias[1]},
+			name:     "duration literal",
+			query:    "now() + '1h30m'",
+			want:     now.Add(90 * time.Minute),
+			wantType: TypeTimestamp,
 		},
 		{
-			name:  "select enum values with alias",
-			query: "/messages_with_alias[@enum_field = 'ALIAS_ENUM2']",
-			want:  []any{holder.MessagesWithAlias[2]},
+			name:     "sum of the durations",
+			query:    "(now() - /people[1]/last_updated) + '30m'",
+			want:     now.Sub(john) + 30*time.Minute,
+			wantType: TypeDuration,
 		},
 	}
 
@@ -635,71 +736,151 @@ func TestFindAllEnum(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pq, err := Compile(tt.query)
 			if err != nil {
-				t.Errorf("Compile() error = %v, no error expected", err)
-				return
+				t.Fatalf("Compile() error = %v, no error expected", err)
 			}
-			res := pq.FindAll(holder)
-			if !deepEqual(res, tt.want) {
-				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			reads = 0
+			res, typ, err := pq.Evaluate(ab, WithClock(clock))
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v, no error expected", err)
+			}
+			if reads != 1 {
+				t.Errorf("clock reads = %d, want 1", reads)
+			}
+			if typ != tt.wantType {
+				t.Errorf("Evaluate() type = %v, want %v", TypeToStr[typ], TypeToStr[tt.wantType])
+			}
+			// deepEqual ignores the unexported fields of time.Time.
+			if c, err := compareTimes(res, tt.want); err != nil || c != 0 {
+				t.Errorf("Evaluate() = %v, want %v", res, tt.want)
 			}
 		})
 	}
 }
 
-func TestFindAllRecursiveDescent(t *testing.T) {
-	tree := &proto.Recursion{
-		Children: []*proto.Recursion{
+func TestFindAllWrappers(t *testing.T) {
+	holder := &proto.ProfilesHolder{
+		Profiles: []*proto.Profile{
 			{
-				StringVal: "A",
-				Children: []*proto.Recursion{
-					{
-						StringVal: "B",
-						IntVal:    2,
-					},
-					{
-						StringVal: "C",
-						Children: []*proto.Recursion{
-							{
-								StringVal: "D",
-								Children: []*proto.Recursion{
-									{
-										StringVal: "B",
-										IntVal:    3,
-									},
-								},
-							},
-						},
-					},
-				},
+				Name:      "Alice",
+				Nickname:  wrapperspb.String("bob"),
+				Verified:  wrapperspb.Bool(false),
+				Age:       wrapperspb.Int32(30),
+				Karma:     wrapperspb.Int64(-5),
+				Visits:    wrapperspb.UInt32(10),
+				Followers: wrapperspb.UInt64(math.MaxUint64),
+				Score:     wrapperspb.Float(0.1),
+				Rating:    wrapperspb.Double(4.5),
+				Avatar:    wrapperspb.Bytes([]byte{0xca, 0xfe}),
 			},
 			{
-				StringVal: "B",
-				IntVal:    1,
+				Name:     "John",
+				Nickname: wrapperspb.String(""),
+				Verified: wrapperspb.Bool(true),
+				Age:      wrapperspb.Int32(0),
+			},
+			{
+				Name: "Carol",
 			},
 		},
-		StringVal: "R",
-		IntVal:    0,
 	}
 
 	tests := []struct {
-		name  string
-		query string
-		want  []any
+		name    string
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
 	}{
 		{
-			name:  "recursively collect matching node values",
-			query: "//children[@string_val='B']/int_val",
-			want:  []any{int32(1), int32(2), int32(3)},
+			name:  "string value",
+			query: "/profiles[@nickname = 'bob']/name",
+			want:  []any{"Alice"},
 		},
 		{
-			name:  "intermediate recursive descent with no explicit node step",
-			query: "/children//[@string_val='B']/int_val",
-			want:  []any{int32(1), int32(2), int32(3)},
+			name:  "empty value is set",
+			query: "/profiles[@nickname = '']/name",
+			want:  []any{"John"},
 		},
 		{
-			name:  "intermediate recursive descent with an explicit node step",
-			query: "/children//children[@string_val='B']/int_val",
-			want:  []any{int32(2), int32(3)},
+			name:  "unset value is null",
+			query: "/profiles[@nickname != 'bob']/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "presence",
+			query: "/profiles[@nickname]/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "unset value is not ordered",
+			query: "/profiles[@age < 100]/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "false bool value is set",
+			query: "/profiles[@verified = false]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "int values",
+			query: "/profiles[@age >= 0 && @karma < 0]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "uint values",
+			query: "/profiles[@visits + 1 = 11 && @followers > 4294967295]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "float values",
+			query: "/profiles[@score = 0.1 && @rating > 4]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "bytes value",
+			query: "/profiles[@avatar = hex'cafe']/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "membership",
+			query: "/profiles[@age in (0, 1)]/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "string function",
+			query: "/profiles[starts-with(@nickname, 'b')]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "path step selects the wrapped value",
+			query: "/profiles/nickname",
+			want:  []any{"bob", ""},
+		},
+		{
+			name:  "explicit value step",
+			query: "/profiles/nickname/value",
+			want:  []any{"bob", ""},
+		},
+		{
+			name:  "sub-path comparison",
+			query: "/profiles[age > 18]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "self filter",
+			query: "/profiles/score[. = 0.1]",
+			want:  []any{float32(0.1)},
+		},
+		{
+			name:  "variable",
+			query: "/profiles[@nickname = $nick]/name",
+			opts:  []FindOption{Bind("nick", wrapperspb.String("bob"))},
+			want:  []any{"Alice"},
+		},
+		{
+			name:    "type mismatch",
+			query:   "/profiles[@nickname > 1]/name",
+			wantErr: ErrTypeMismatch,
 		},
 	}
 
@@ -707,22 +888,3200 @@ func TestFindAllRecursiveDescent(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pq, err := Compile(tt.query)
 			if err != nil {
-				t.Errorf("Compile() error = %v, no error expected", err)
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(holder, append(tt.opts, WithStrict(true))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
 				return
 			}
-			res := pq.FindAll(tree)
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
 			if !deepEqual(res, tt.want) {
-				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
 			}
 		})
 	}
 }
 
-func TestFindAllWildcard(t *testing.T) {
-	store := &proto.Bookstore{
-		Books: []*proto.Book{
+func TestFindAllScalarKinds(t *testing.T) {
+	holder := &proto.ScalarsHolder{
+		Items: []*proto.Scalars{
 			{
-				Title:  "The Go Programming Language",
+				DoubleField:   0.1,
+				FloatField:    0.1,
+				Int32Field:    -32,
+				Int64Field:    math.MinInt64,
+				Uint32Field:   math.MaxUint32,
+				Uint64Field:   math.MaxUint64,
+				Sint32Field:   -7,
+				Sint64Field:   -64,
+				Fixed32Field:  32,
+				Fixed64Field:  1 << 63,
+				Sfixed32Field: -1,
+				Sfixed64Field: math.MaxInt64,
+				BoolField:     true,
+				StringField:   "a",
+				BytesField:    []byte("abc"),
+				EnumField:     proto.Scalars_ENUM_ONE,
+			},
+			{
+				DoubleField:   2.5,
+				FloatField:    2.5,
+				Int32Field:    32,
+				Int64Field:    64,
+				Uint32Field:   1,
+				Uint64Field:   2,
+				Sint32Field:   7,
+				Sint64Field:   64,
+				Fixed32Field:  3,
+				Fixed64Field:  4,
+				Sfixed32Field: 1,
+				Sfixed64Field: -1,
+				StringField:   "b",
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "double",
+			query: "/items[@double_field = 0.1]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "float32 equality",
+			query: "/items[@float_field = 0.1]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "float32 ordering",
+			query: "/items[@float_field >= 0.1 && @float_field < 2.5]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "float32 repeated scalar",
+			query: "/items[float_field = 2.5]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "float and int",
+			query: "/items[@double_field > 2]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "int32",
+			query: "/items[@int32_field < 0]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "int64 min",
+			query: "/items[@int64_field = -9223372036854775807 - 1]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "uint32",
+			query: "/items[@uint32_field = 4294967295]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "uint64 beyond int64",
+			query: "/items[@uint64_field > 9223372036854775807]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "uint64 and negative int",
+			query: "/items[@uint64_field > -1]/string_field",
+			want:  []any{"a", "b"},
+		},
+		{
+			name:  "uint64 and float",
+			query: "/items[@uint64_field > 1.5]/string_field",
+			want:  []any{"a", "b"},
+		},
+		{
+			name:  "sint32",
+			query: "/items[@sint32_field = -7]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "sint64",
+			query: "/items[@sint64_field > 0]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "fixed32",
+			query: "/items[@fixed32_field = 32]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "fixed64",
+			query: "/items[@fixed64_field >= 9223372036854775807]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "sfixed32",
+			query: "/items[@sfixed32_field < 0]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "sfixed64",
+			query: "/items[@sfixed64_field = 9223372036854775807]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "unsigned arithmetic",
+			query: "/items[@fixed32_field + @uint64_field = 5]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "unsigned 32-bit arithmetic",
+			query: "/items[@fixed32_field + @uint32_field = 4]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "mixed integer arithmetic",
+			query: "/items[@sint32_field - @fixed32_field = 4]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "bool",
+			query: "/items[@bool_field = true]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "string",
+			query: "/items[@string_field = 'b']/int32_field",
+			want:  []any{int32(32)},
+		},
+		{
+			name:  "bytes",
+			query: "/items[@bytes_field = hex'616263']/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "enum",
+			query: "/items[@enum_field = 'ENUM_ONE']/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "membership",
+			query: "/items[@fixed64_field in (4, 9223372036854775807)]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "float32 membership",
+			query: "/items[@float_field in (0.1, 0.2)]/string_field",
+			want:  []any{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := CompileFor(tt.query, holder.ProtoReflect().Descriptor())
+			if err != nil {
+				t.Fatalf("CompileFor() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(holder, WithStrict(true))
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+
+	evals := []struct {
+		query    string
+		want     any
+		wantType Type
+	}{
+		{query: "/items[0]/uint64_field - /items[1]/uint64_field", want: uint64(math.MaxUint64 - 2), wantType: TypeUint},
+		{query: "/items[1]/fixed32_field + /items[1]/uint64_field", want: uint64(5), wantType: TypeUint},
+		{query: "/items[1]/fixed32_field - 4", want: int64(-1), wantType: TypeInt},
+		{query: "/items[1]/float_field / 2", want: float64(1.25), wantType: TypeFloat},
+		{query: "/items[0]/uint64_field - 1", want: uint64(math.MaxUint64 - 1), wantType: TypeUint},
+		{query: "/items[0]/uint64_field + 0", want: uint64(math.MaxUint64), wantType: TypeUint},
+		{query: "/items[0]/uint64_field - 18446744073709551614", want: uint64(1), wantType: TypeUint},
+		{query: "18446744073709551615", want: uint64(math.MaxUint64), wantType: TypeUint},
+		{query: "-9223372036854775808", want: int64(math.MinInt64), wantType: TypeInt},
+		{query: "count(/items[@uint64_field = 18446744073709551615])", want: int64(1), wantType: TypeInt},
+		{query: "/items[0]/uint64_field + 1", want: uint64(0), wantType: TypeUint},
+		{query: "/items[1]/uint32_field - /items[1]/uint64_field", want: uint64(math.MaxUint64), wantType: TypeUint},
+	}
+	for _, tt := range evals {
+		pq, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v, no error expected", tt.query, err)
+		}
+		res, typ, err := pq.Evaluate(holder)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error = %v, no error expected", tt.query, err)
+		}
+		if res != tt.want || typ != tt.wantType {
+			t.Errorf("Evaluate(%q) = %v (%v), want %v (%v)", tt.query, res, TypeToStr[typ], tt.want, TypeToStr[tt.wantType])
+		}
+	}
+
+	// The unsigned values beyond the int64 range are only combined with the
+	// non-negative signed integers.
+	evalErrs := []struct {
+		query   string
+		wantErr error
+	}{
+		{query: "/items[0]/uint64_field + -1", wantErr: ErrInvalidType},
+	}
+	for _, tt := range evalErrs {
+		pq, err := Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v, no error expected", tt.query, err)
+		}
+		if _, _, err := pq.Evaluate(holder); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Evaluate(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+		}
+	}
+
+	if _, err := Compile("18446744073709551616"); err == nil {
+		t.Errorf("Compile(%q) error = nil, want an error", "18446744073709551616")
+	}
+}
+
+func TestFindAllBytes(t *testing.T) {
+	holder := &proto.ScalarsHolder{
+		Items: []*proto.Scalars{
+			{StringField: "a", BytesField: []byte{0xde, 0xad, 0xbe, 0xef}},
+			{StringField: "b", BytesField: []byte("abc")},
+			{StringField: "c", BytesField: []byte{0xff, 0xfe}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "hex literal",
+			query: "/items[@bytes_field = hex'DEADbeef']/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "base64 literal",
+			query: "/items[@bytes_field = b64'YWJj']/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "ordering",
+			query: "/items[@bytes_field > hex'de']/string_field",
+			want:  []any{"a", "c"},
+		},
+		{
+			name:  "hex function",
+			query: "/items[hex(@bytes_field) = 'deadbeef']/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "base64 function",
+			query: "/items[base64(@bytes_field) = '//4=']/string_field",
+			want:  []any{"c"},
+		},
+		{
+			name:  "bytes length",
+			query: "/items[bytes-length(@bytes_field) = 3]/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "bytes prefix",
+			query: "/items[has-prefix-bytes(@bytes_field, hex'dead')]/string_field",
+			want:  []any{"a"},
+		},
+		{
+			name:  "utf8 decoding",
+			query: "/items[@string_field = 'b'][utf8(@bytes_field) = 'abc']/string_field",
+			want:  []any{"b"},
+		},
+		{
+			name:  "membership",
+			query: "/items[@bytes_field in (hex'fffe', b64'YWJj')]/string_field",
+			want:  []any{"b", "c"},
+		},
+		{
+			name:  "bytes variable",
+			query: "/items[@bytes_field = $digest]/string_field",
+			opts:  []FindOption{Bind("digest", []byte{0xff, 0xfe})},
+			want:  []any{"c"},
+		},
+		{
+			name:    "no implicit decoding",
+			query:   "/items[@bytes_field = 'abc']/string_field",
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "invalid utf8",
+			query:   "/items[utf8(@bytes_field) = 'abc']/string_field",
+			wantErr: ErrInvalidType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(holder, append(tt.opts, WithStrict(true))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+
+	for _, q := range []string{"/items[@bytes_field = hex'xyz']", "/items[@bytes_field = b64'!']", "/items[has-prefix-bytes(@bytes_field, 'a')]"} {
+		if _, err := Compile(q); err == nil {
+			t.Errorf("Compile(%q) error = nil, want an error", q)
+		}
+	}
+
+	pq, err := Compile("/items[2]/bytes_field[0:1] = hex'ff'")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	if res, typ, err := pq.Evaluate(holder); err != nil || res != true || typ != TypeBool {
+		t.Errorf("Evaluate() = %v, %v, %v, want true", res, TypeToStr[typ], err)
+	}
+}
+
+func TestFindAllListBuiltins(t *testing.T) {
+	store := proto.Bookstore{
+		Books: []*proto.Book{
+			{
+				Title:  "The Go Programming Language",
+				Author: "Alan A. A. Donovan",
+				Price:  34.99,
+			},
+			{
+				Title:  "The Rust Programming Language",
+				Author: "Steve Klabnik",
+				Price:  39.99,
+			},
+			{
+				Title: "The Bible",
+				Price: 0.00,
+			},
+		},
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "return the last element of the list",
+			query: "/books[length() - 1]",
+			want:  []any{store.Books[2]},
+		},
+		{
+			name:  "out-of-bounds index with length",
+			query: "/books[length() - 100]",
+			want:  []any{},
+		},
+		{
+			name:  "position in a boolean context",
+			query: "/books[position() <= 1]",
+			want:  []any{store.Books[0], store.Books[1]},
+		},
+		{
+			name:  "position with unexpected type",
+			query: "/books[position() > true]",
+			want:  []any{},
+		},
+		{
+			name:  "position with unexpected operand",
+			query: "/books[position() + 1]",
+			want:  []any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			res := pq.FindAll(&store)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllEnum(t *testing.T) {
+	holder := &proto.MessageWithEnumHolder{
+		Messages: []*proto.MessageWithEnum{
+			{
+				EnumField:   proto.MessageWithEnum_ENUM1,
+				StringField: "message with enum1",
+			},
+			{
+				EnumField:   proto.MessageWithEnum_ENUM2,
+				StringField: "message with enum2",
+			},
+			{
+				EnumField:   proto.MessageWithEnum_ENUM3,
+				StringField: "message with enum3",
+			},
+			{
+				// Unset enum would be evaluated to the default int
+				// value which is 0. I.e. An unset enum is trivially
+				// equal to the first enum value.
+				StringField: "message with empty enum",
+			},
+		},
+		MessagesWithAlias: []*proto.MessageWithAllowAliasEnum{
+			{
+				EnumField:   proto.MessageWithAllowAliasEnum_ENUM1,
+				StringField: "message with enum1",
+			},
+			{
+				EnumField:   proto.MessageWithAllowAliasEnum_ENUM2,
+				StringField: "message with enum2",
+			},
+			{
+				EnumField:   proto.MessageWithAllowAliasEnum_ENUM3,
+				StringField: "message with enum3 (alias enum2)",
+			},
+		},
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "single enum selector",
+			query: "/messages[@enum_field = 'ENUM1']",
+			want:  []any{holder.Messages[0], holder.Messages[3]},
+		},
+		{
+			name:  "single enum selector",
+			query: "/messages[@enum_field = 'ENUM2']",
+			want:  []any{holder.Messages[1]},
+		},
+		{
+			name:  "single enum selector",
+			query: "/messages[@enum_field = 'ENUM3']",
+			want:  []any{holder.Messages[2]},
+		},
+		{
+			name:  "single enum selector with a non-existing enum value",
+			query: "/messages[@enum_field = 'ENUM4']",
+			want:  []any{},
+		},
+		{
+			name:  "select enum values failing",
+			query: "/messages/enum_field",
+			want:  []any{"ENUM1", "ENUM2", "ENUM3", "ENUM1"},
+		},
+		{
+			name:  "select enum values with alias",
+			query: "/messages_with_alias[@enum_field = 'ENUM2']",
+			want:  []any{holder.MessagesWithAlias[1]},
+		},
+		{
+			name:  "select enum values with alias",
+			query: "/messages_with_alias[@enum_field = 'ALIAS_ENUM2']",
+			want:  []any{holder.MessagesWithAlias[2]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			res := pq.FindAll(holder)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllStringFunctions(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:  "Alice Smith",
+				Email: "alice@example.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "+1-555-0100", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+			},
+			{
+				Name:  " John Doe ",
+				Email: "john@corp.org",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "+44-555-0200", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "Bob",
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  []CompileOption
+		want  []any
+	}{
+		{
+			name:  "ends-with",
+			query: "/people[ends-with(@email, '@example.com')]/name",
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "starts-with",
+			query: "/people[starts-with(@email, 'john')]/name",
+			want:  []any{" John Doe "},
+		},
+		{
+			name:  "contains",
+			query: "/people[contains(@name, 'o')]/name",
+			want:  []any{" John Doe ", "Bob"},
+		},
+		{
+			name:  "unset properties are empty strings",
+			query: "/people[!contains(@email, '@')]/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "contains on a sub-path",
+			query: "/people[contains(phones/number, '+44')]/name",
+			want:  []any{" John Doe "},
+		},
+		{
+			name:  "contains on an enum",
+			query: "/people/phones[contains(@type, 'WORK')]/number",
+			want:  []any{"+44-555-0200"},
+		},
+		{
+			name:  "string-length",
+			query: "/people[string-length(@name) = 3]/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "substring",
+			query: "/people[substring(@name, 0, 5) = 'Alice']/name",
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "substring without a length",
+			query: "/people[substring(@email, 5) = '@example.com']/name",
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "xpath substring",
+			query: "/people[substring(@name, 1, 5) = 'Alice']/name",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "substring out of range",
+			query: "/people[substring(@name, 9, 100) = 'th']/name",
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "substring with the max length",
+			query: "/people[substring(@name, 1, 9223372036854775807) = 'ob']/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "substring with a negative start",
+			query: "/people[substring(@name, -1, 3) = 'Bo']/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "concat",
+			query: "/people[concat(@name, ' <', @email, '>') = 'Bob <>']/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "lower and upper",
+			query: "/people[(lower(@name) = 'bob') || upper(@name) = 'ALICE SMITH']/name",
+			want:  []any{"Alice Smith", "Bob"},
+		},
+		{
+			name:  "trim",
+			query: "/people[trim(@name) = 'John Doe']/name",
+			want:  []any{" John Doe "},
+		},
+		{
+			name:  "replace",
+			query: "/people/phones[replace(@number, '-', '') = '+15550100']/number",
+			want:  []any{"+1-555-0100"},
+		},
+		{
+			name:  "split-part",
+			query: "/people/phones[split-part(@number, '-', 0) = '+44']/number",
+			want:  []any{"+44-555-0200"},
+		},
+		{
+			name:  "xpath split-part",
+			query: "/people/phones[split-part(@number, '-', 3) = '0100']/number",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"+1-555-0100"},
+		},
+		{
+			name:  "split-part out of range",
+			query: "/people/phones[split-part(@number, '-', 5) = '']/number",
+			want:  []any{"+1-555-0100", "+44-555-0200"},
+		},
+		{
+			name:  "format",
+			query: "/people[format('%s:%d', @email, string-length(@email)) = 'john@corp.org:13']/name",
+			want:  []any{" John Doe "},
+		},
+		{
+			name:  "argument type mismatch",
+			query: "/people[contains(@name, phones)]/name",
+			want:  []any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, tt.opts...)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(ab)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllRegex(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{Name: "Alice Smith", Email: "alice@example.com"},
+			{Name: "John Doe", Email: "john.doe@corp.org"},
+			{Name: "Bob"},
+		},
+	}
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "The Go Programming Language", Author: "Alan Donovan"},
+			{Title: "Programming Rust", Author: "Jim Blandy"},
+			{Title: "The Bible"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		msg     protoreflect.ProtoMessage
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "match operator",
+			query: "/people[@email =~ '@example\\.(com|org)$']/name",
+			msg:   ab,
+			want:  []any{"Alice Smith"},
+		},
+		{
+			name:  "match operator on an unset property",
+			query: "/people[@email =~ '^$']/name",
+			msg:   ab,
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "matches function",
+			query: "/people[matches(@email, '^[a-z]+\\.[a-z]+@')]/name",
+			msg:   ab,
+			want:  []any{"John Doe"},
+		},
+		{
+			name:  "negated match",
+			query: "/books[!(@title =~ '(?i)programming')]/title",
+			msg:   store,
+			want:  []any{"The Bible"},
+		},
+		{
+			name:  "pattern from a property",
+			query: "/books[matches(@title, @author)]/title",
+			msg:   store,
+			want:  []any{"The Bible"},
+		},
+		{
+			name:  "match on a sub-path",
+			query: "/books[title =~ '^The']/author",
+			msg:   store,
+			want:  []any{"Alan Donovan", ""},
+		},
+		{
+			name:    "invalid literal pattern",
+			query:   "/books[@title =~ '(']",
+			msg:     store,
+			wantErr: ErrInvalidRegex,
+		},
+		{
+			name:    "invalid literal pattern in a function",
+			query:   "/books[matches(@title, '[a-')]",
+			msg:     store,
+			wantErr: ErrInvalidRegex,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Compile() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(tt.msg)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllAggregates(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "1", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "2", Type: proto.PhoneType_PHONE_TYPE_WORK},
+					{Number: "3", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "4", Type: proto.PhoneType_PHONE_TYPE_HOME},
+				},
+			},
+			{
+				Name: "Bob",
+			},
+		},
+	}
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "A", Price: 50, Pages: 100},
+			{Title: "B", Price: 30.5, Pages: 300},
+			{Title: "C", Price: 25, Pages: 200, OnSale: true},
+		},
+	}
+	scalars := &proto.RepeatedScalarHolder{
+		Items: []*proto.RepeatedScalarsItem{
+			{Int32S: []int32{1, 2, 3}, Strings: []string{"a", "b", "a"}},
+			{Int32S: []int32{10}, Strings: []string{"c"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		msg   protoreflect.ProtoMessage
+		want  []any
+	}{
+		{
+			name:  "count",
+			query: "/people[count(phones) > 2]/name",
+			msg:   ab,
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "count of an empty node set",
+			query: "/people[count(phones) = 0]/name",
+			msg:   ab,
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "count of a filtered node set",
+			query: "/people[count(phones[@type = 'PHONE_TYPE_WORK']) = 2]/name",
+			msg:   ab,
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "distinct-count",
+			query: "/people[distinct-count(phones/type) = 2]/name",
+			msg:   ab,
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "sum",
+			query: "/.[sum(books/price) > 100]/books[0]/title",
+			msg:   store,
+			want:  []any{"A"},
+		},
+		{
+			name:  "sum below the threshold",
+			query: "/.[sum(books/price) > 110]/books[0]/title",
+			msg:   store,
+			want:  []any{},
+		},
+		{
+			name:  "sum of integers",
+			query: "/.[sum(books/pages) = 600]/books[0]/title",
+			msg:   store,
+			want:  []any{"A"},
+		},
+		{
+			name:  "min and max",
+			query: "/books[(@price = max($root/books/price)) || @price = min($root/books/price)]/title",
+			msg:   store,
+			want:  []any{"A", "C"},
+		},
+		{
+			name:  "avg",
+			query: "/books[@pages > avg($root/books/pages)]/title",
+			msg:   store,
+			want:  []any{"B"},
+		},
+		{
+			name:  "repeated scalar property",
+			query: "/items[sum(@int32s) = 6]/strings",
+			msg:   scalars,
+			want:  []any{"a", "b", "a"},
+		},
+		{
+			name:  "distinct repeated scalars",
+			query: "/items[distinct-count(strings) < count(strings)]/int32s",
+			msg:   scalars,
+			want:  []any{int32(1), int32(2), int32(3)},
+		},
+		{
+			name:  "avg of an empty node set",
+			query: "/people[avg(phones/number) > 0]/name",
+			msg:   ab,
+			want:  []any{},
+		},
+		{
+			name:  "sum of non-numeric values",
+			query: "/items[sum(strings) > 0]/int32s",
+			msg:   scalars,
+			want:  []any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(tt.msg)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllMembership(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Id:   1,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "John",
+				Id:   2,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "224", Type: proto.PhoneType_PHONE_TYPE_HOME},
+				},
+			},
+			{
+				Name: "Bob",
+				Id:   4,
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "enum in",
+			query: "/people/phones[@type in ('PHONE_TYPE_WORK', 'PHONE_TYPE_HOME')]/number",
+			want:  []any{"123", "224"},
+		},
+		{
+			name:  "int not in",
+			query: "/people[@id not in (1, 2, 3)]/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "string in",
+			query: "/people[@name in ('Bob', 'Alice')]/id",
+			want:  []any{int32(1), int32(4)},
+		},
+		{
+			name:  "int in floats",
+			query: "/people[@id in (2.0, 4.5)]/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "negative literal",
+			query: "/people[@id in (-1, 1)]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "single element",
+			query: "/people[@id in (2)]/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "empty list",
+			query: "/people[@id in ()]/name",
+			want:  []any{},
+		},
+		{
+			name:  "node set subject",
+			query: "/people[phones/number in ('224')]/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "combined with other conditions",
+			query: "/people[@id in (1, 2) && @name != 'Alice' || @id = 4]/name",
+			want:  []any{"John", "Bob"},
+		},
+		{
+			name:  "negated",
+			query: "/people[!(@id in (1, 2))]/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "variable set",
+			query: "/people[@name in $names]/id",
+			opts:  []FindOption{Bind("names", []string{"John", "Bob"})},
+			want:  []any{int32(2), int32(4)},
+		},
+		{
+			name:    "type mismatch",
+			query:   "/people[@name in (1, 2)]/id",
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "single-element list type mismatch",
+			query:   "/people[@name in (1)]/id",
+			wantErr: ErrTypeMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(ab, append(tt.opts, WithStrict(true))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+
+	for _, q := range []string{"/people[@id in (1, 'a')]", "/people[@id in (1, @id)]", "/people[@id in (1, 2]", "/people[@id in (@id)]"} {
+		if _, err := Compile(q); err == nil {
+			t.Errorf("Compile(%q) error = nil, want an error", q)
+		}
+	}
+}
+
+func TestFindAllSlices(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "A"},
+			{Title: "B"},
+			{Title: "C"},
+			{Title: "D"},
+			{Title: "Ünïcode"},
+		},
+	}
+	scalars := &proto.RepeatedScalarHolder{
+		Items: []*proto.RepeatedScalarsItem{
+			{Bytes: []byte{1, 2, 3, 4}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []CompileOption
+		msg     protoreflect.ProtoMessage
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "negative index",
+			query: "/books[-1]/title",
+			msg:   store,
+			want:  []any{"Ünïcode"},
+		},
+		{
+			name:  "negative index with xpath positions",
+			query: "/books[-2]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			msg:   store,
+			want:  []any{"D"},
+		},
+		{
+			name:  "zero index with xpath positions",
+			query: "/books[0]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			msg:   store,
+			want:  []any{},
+		},
+		{
+			name:  "negative index out of range",
+			query: "/books[-6]/title",
+			msg:   store,
+			want:  []any{},
+		},
+		{
+			name:  "slice",
+			query: "/books[1:3]/title",
+			msg:   store,
+			want:  []any{"B", "C"},
+		},
+		{
+			name:  "slice without a start",
+			query: "/books[:2]/title",
+			msg:   store,
+			want:  []any{"A", "B"},
+		},
+		{
+			name:  "slice without a stop",
+			query: "/books[-2:]/title",
+			msg:   store,
+			want:  []any{"D", "Ünïcode"},
+		},
+		{
+			name:  "slice with a step",
+			query: "/books[::2]/title",
+			msg:   store,
+			want:  []any{"A", "C", "Ünïcode"},
+		},
+		{
+			name:  "reversed slice",
+			query: "/books[3::-2]/title",
+			msg:   store,
+			want:  []any{"D", "B"},
+		},
+		{
+			name:  "slice out of range",
+			query: "/books[3:100]/title",
+			msg:   store,
+			want:  []any{"D", "Ünïcode"},
+		},
+		{
+			name:  "slice bounds are expressions",
+			query: "/books[1:last()]/title",
+			msg:   store,
+			want:  []any{"B", "C", "D"},
+		},
+		{
+			name:  "slice followed by a filter",
+			query: "/books[:3][@title != 'B']/title",
+			msg:   store,
+			want:  []any{"A", "C"},
+		},
+		{
+			name:  "string index",
+			query: "/books[-1]/title[0]",
+			msg:   store,
+			want:  []any{"Ü"},
+		},
+		{
+			name:  "negative string index",
+			query: "/books[-1]/title[-2]",
+			msg:   store,
+			want:  []any{"d"},
+		},
+		{
+			name:  "string slice",
+			query: "/books[-1]/title[1:4]",
+			msg:   store,
+			want:  []any{"nïc"},
+		},
+		{
+			name:  "empty string slice",
+			query: "/books[-1]/title[100:]",
+			msg:   store,
+			want:  []any{""},
+		},
+		{
+			name:  "bytes index",
+			query: "/items/bytes[-1]",
+			msg:   scalars,
+			want:  []any{uint32(4)},
+		},
+		{
+			name:  "bytes slice",
+			query: "/items/bytes[1:3]",
+			msg:   scalars,
+			want:  []any{[]byte{2, 3}},
+		},
+		{
+			name:  "empty bytes slice",
+			query: "/items/bytes[3:1]",
+			msg:   scalars,
+			want:  []any{[]byte{}},
+		},
+		{
+			name:  "step longer than the list",
+			query: "/books[1::9223372036854775807]/title",
+			msg:   store,
+			want:  []any{"B"},
+		},
+		{
+			name:  "negative step longer than the list",
+			query: "/books[3::-9223372036854775807]/title",
+			msg:   store,
+			want:  []any{"D"},
+		},
+		{
+			name:  "step longer than the string",
+			query: "/books[0]/title[0::9223372036854775807]",
+			msg:   store,
+			want:  []any{"A"},
+		},
+		{
+			name:  "negative step longer than the string",
+			query: "/books[-1]/title[::-9223372036854775807]",
+			msg:   store,
+			want:  []any{"e"},
+		},
+		{
+			name:  "step longer than the bytes",
+			query: "/items/bytes[1::9223372036854775807]",
+			msg:   scalars,
+			want:  []any{[]byte{2}},
+		},
+		{
+			name:    "zero step",
+			query:   "/books[::0]/title",
+			msg:     store,
+			wantErr: ErrInvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, tt.opts...)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(tt.msg, WithStrict(true))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllPositions(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "The Go Programming Language"},
+			{Title: "The Rust Programming Language"},
+			{Title: "The Bible"},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  []CompileOption
+		want  []any
+	}{
+		{
+			name:  "last index",
+			query: "/books[last()]/title",
+			want:  []any{"The Bible"},
+		},
+		{
+			name:  "first index",
+			query: "/books[first()]/title",
+			want:  []any{"The Go Programming Language"},
+		},
+		{
+			name:  "last in a filter",
+			query: "/books[position() = last()]/title",
+			want:  []any{"The Bible"},
+		},
+		{
+			name:  "last in a filter chain",
+			query: "/books[position() > first()][position() < last()]/title",
+			want:  []any{"The Rust Programming Language"},
+		},
+		{
+			name:  "xpath index",
+			query: "/books[1]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"The Go Programming Language"},
+		},
+		{
+			name:  "xpath last index",
+			query: "/books[last()]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"The Bible"},
+		},
+		{
+			name:  "xpath position",
+			query: "/books[position() = 2]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"The Rust Programming Language"},
+		},
+		{
+			name:  "xpath position and last",
+			query: "/books[position() >= first()][position() < last()]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{"The Go Programming Language", "The Rust Programming Language"},
+		},
+		{
+			name:  "xpath out of range index",
+			query: "/books[0]/title",
+			opts:  []CompileOption{WithXPathPositions()},
+			want:  []any{},
+		},
+		{
+			name:  "position of an indexed element",
+			query: "/books[2][position() = 2]/title",
+			want:  []any{"The Bible"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, tt.opts...)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(store)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllRecursiveDescent(t *testing.T) {
+	tree := &proto.Recursion{
+		Children: []*proto.Recursion{
+			{
+				StringVal: "A",
+				Children: []*proto.Recursion{
+					{
+						StringVal: "B",
+						IntVal:    2,
+					},
+					{
+						StringVal: "C",
+						Children: []*proto.Recursion{
+							{
+								StringVal: "D",
+								Children: []*proto.Recursion{
+									{
+										StringVal: "B",
+										IntVal:    3,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				StringVal: "B",
+				IntVal:    1,
+			},
+		},
+		StringVal: "R",
+		IntVal:    0,
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "recursively collect matching node values",
+			query: "//children[@string_val='B']/int_val",
+			want:  []any{int32(1), int32(2), int32(3)},
+		},
+		{
+			name:  "intermediate recursive descent with no explicit node step",
+			query: "/children//[@string_val='B']/int_val",
+			want:  []any{int32(1), int32(2), int32(3)},
+		},
+		{
+			name:  "intermediate recursive descent with an explicit node step",
+			query: "/children//children[@string_val='B']/int_val",
+			want:  []any{int32(2), int32(3)},
+		},
+		{
+			name:  "position in a recursive descent",
+			query: "//[position() = 1]/string_val",
+			want:  []any{"B", "C"},
+		},
+		{
+			name:  "last in a recursive descent",
+			query: "//[position() = last()]/string_val",
+			want:  []any{"B", "C", "D", "B"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			res := pq.FindAll(tree)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllWildcard(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{
+				Title:  "The Go Programming Language",
+				Author: "Alan A. A. Donovan",
+				Price:  34.99,
+			},
+			{
+				Title:  "The Rust Programming Language",
+				Author: "Steve Klabnik",
+				Price:  39.99,
+			},
+			{
+				Title: "The Bible",
+				Price: 0.00,
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "select all books",
+			query: "/*",
+			want:  []any{store.Books[0], store.Books[1], store.Books[2]},
+		},
+		{
+			name:  "select all book properties",
+			query: "/books[0]/*",
+			want: []any{
+				"The Go Programming Language",
+				"Alan A. A. Donovan",
+				float32(34.99),
+				int32(0),
+				false,
+			},
+		},
+		{
+			name:  "select all properties of all books",
+			query: "/*/*",
+			want: []any{
+				"The Go Programming Language", "Alan A. A. Donovan", float32(34.99), int32(0), false,
+				"The Rust Programming Language", "Steve Klabnik", float32(39.99), int32(0), false,
+				"The Bible", "", float32(0.00), int32(0), false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			res := pq.FindAll(store)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllFromREADME(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:  "Alice",
+				Email: "alice@corp.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "123457", Type: proto.PhoneType_PHONE_TYPE_HOME},
+					{Number: "123458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name:  "John",
+				Email: "john@corp.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "223457", Type: proto.PhoneType_PHONE_TYPE_HOME},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name:  "Bob",
+				Email: "bob@corp.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "323457", Type: proto.PhoneType_PHONE_TYPE_HOME},
+					{Number: "323458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "select first work phone number",
+			query: "/people[@name='John']/phones[@type='PHONE_TYPE_WORK'][0]/number",
+			want:  []any{"223458"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			res := pq.FindAll(ab)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFirstExistsCount(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{
+				Title:  "The Go Programming Language",
+				Author: "Alan A. A. Donovan",
+				Price:  34.99,
+			},
+			{
+				Title:  "The Rust Programming Language",
+				Author: "Steve Klabnik",
+				Price:  39.99,
+			},
+			{
+				Title: "The Bible",
+				Price: 0.00,
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFirst  any
+		wantExists bool
+		wantCount  int
+	}{
+		{
+			name:       "multiple matches",
+			query:      "/books[@author]/title",
+			wantFirst:  "The Go Programming Language",
+			wantExists: true,
+			wantCount:  2,
+		},
+		{
+			name:       "single match",
+			query:      "/books[@price>35]",
+			wantFirst:  store.Books[1],
+			wantExists: true,
+			wantCount:  1,
+		},
+		{
+			name:       "no matches",
+			query:      "/books[@title='The Lord of the Rings']",
+			wantFirst:  nil,
+			wantExists: false,
+			wantCount:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			first, found := pq.FindFirst(store)
+			if found != tt.wantExists {
+				t.Errorf("FindFirst() found = %v, want %v", found, tt.wantExists)
+			}
+			if found && !deepEqual(first, tt.wantFirst) {
+				t.Errorf("FindFirst() = %+v, want %+v", first, tt.wantFirst)
+			}
+			if exists := pq.Exists(store); exists != tt.wantExists {
+				t.Errorf("Exists() = %v, want %v", exists, tt.wantExists)
+			}
+			if cnt := pq.Count(store); cnt != tt.wantCount {
+				t.Errorf("Count() = %v, want %v", cnt, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestAllAndWalk(t *testing.T) {
+	tree := &proto.Recursion{
+		StringVal: "R",
+		Children: []*proto.Recursion{
+			{StringVal: "A", IntVal: 1},
+			{StringVal: "B", IntVal: 2},
+			{StringVal: "C", IntVal: 3},
+		},
+	}
+
+	pq, err := Compile("/children/int_val")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []any
+	}{
+		{
+			name:  "full iteration",
+			limit: -1,
+			want:  []any{int32(1), int32(2), int32(3)},
+		},
+		{
+			name:  "early termination",
+			limit: 2,
+			want:  []any{int32(1), int32(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []any{}
+			for v := range pq.All(tree) {
+				if len(got) == tt.limit {
+					break
+				}
+				got = append(got, v)
+			}
+			if !deepEqual(got, tt.want) {
+				t.Errorf("All() = %+v, want %+v", got, tt.want)
+			}
+
+			got = []any{}
+			pq.Walk(tree, func(v any) bool {
+				got = append(got, v)
+				return len(got) != tt.limit
+			})
+			if !deepEqual(got, tt.want) {
+				t.Errorf("Walk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindNodes(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+		},
+	}
+	messages := &proto.MessageWithMapHolder{
+		MessagesWithMap: []*proto.MessageWithMap{
+			{
+				StringInnerMap: map[string]*proto.MessageWithMap_InnerMessage{
+					"k": {InnerInt: 1},
+				},
+				Int32InnerMap: map[int32]*proto.MessageWithMap_InnerMessage{
+					123: {InnerInt: 2},
+				},
+			},
+		},
+	}
+	holder := &proto.RepeatedScalarHolder{
+		Items: []*proto.RepeatedScalarsItem{
+			{Bytes: []byte{1, 2, 3}},
+		},
+	}
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "The Go Programming Language"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		root       protoreflect.ProtoMessage
+		wantPaths  []string
+		wantValues []any
+		wantFields []string
+	}{
+		{
+			name:       "root node",
+			query:      "/",
+			root:       store,
+			wantPaths:  []string{"/"},
+			wantValues: []any{store},
+			wantFields: []string{""},
+		},
+		{
+			name:       "list elements",
+			query:      "/people/name",
+			root:       ab,
+			wantPaths:  []string{"/people[0]/name", "/people[1]/name"},
+			wantValues: []any{"Alice", "John"},
+			wantFields: []string{"name", "name"},
+		},
+		{
+			name:       "filtered list elements keep original indices",
+			query:      "/people[@name='John']/phones[@type='PHONE_TYPE_WORK']/number",
+			root:       ab,
+			wantPaths:  []string{"/people[1]/phones[1]/number"},
+			wantValues: []any{"223458"},
+			wantFields: []string{"number"},
+		},
+		{
+			name:       "indexed nested list element",
+			query:      "/people[1]/phones[0]/type",
+			root:       ab,
+			wantPaths:  []string{"/people[1]/phones[0]/type"},
+			wantValues: []any{"PHONE_TYPE_MOBILE"},
+			wantFields: []string{"type"},
+		},
+		{
+			name:       "indexed list element",
+			query:      "/books[0]",
+			root:       store,
+			wantPaths:  []string{"/books[0]"},
+			wantValues: []any{store.Books[0]},
+			wantFields: []string{"books"},
+		},
+		{
+			name:       "recursive descent",
+			query:      "//phones[@type='PHONE_TYPE_MOBILE']/number",
+			root:       ab,
+			wantPaths:  []string{"/people[0]/phones[0]/number", "/people[1]/phones[0]/number"},
+			wantValues: []any{"123456", "223456"},
+			wantFields: []string{"number", "number"},
+		},
+		{
+			name:       "string map key",
+			query:      "/messages_with_map/string_inner_map['k']/inner_int",
+			root:       messages,
+			wantPaths:  []string{"/messages_with_map[0]/string_inner_map['k']/inner_int"},
+			wantValues: []any{int32(1)},
+			wantFields: []string{"inner_int"},
+		},
+		{
+			name:       "int map key",
+			query:      "/messages_with_map/int32_inner_map[123]/inner_int",
+			root:       messages,
+			wantPaths:  []string{"/messages_with_map[0]/int32_inner_map[123]/inner_int"},
+			wantValues: []any{int32(2)},
+			wantFields: []string{"inner_int"},
+		},
+		{
+			name:       "string slice",
+			query:      "/books[0]/title[-8:]",
+			root:       store,
+			wantPaths:  []string{"/books[0]/title[19:27]"},
+			wantValues: []any{"Language"},
+			wantFields: []string{"title"},
+		},
+		{
+			name:       "empty string slice",
+			query:      "/books[0]/title[5:1]",
+			root:       store,
+			wantPaths:  []string{"/books[0]/title[0:0]"},
+			wantValues: []any{""},
+			wantFields: []string{"title"},
+		},
+		{
+			name:       "reversed bytes slice",
+			query:      "/items/bytes[::-2]",
+			root:       holder,
+			wantPaths:  []string{"/items[0]/bytes[2::-2]"},
+			wantValues: []any{[]byte{3, 1}},
+			wantFields: []string{"bytes"},
+		},
+		{
+			name:       "bytes element",
+			query:      "/items/bytes[2]",
+			root:       holder,
+			wantPaths:  []string{"/items[0]/bytes[2]"},
+			wantValues: []any{uint32(3)},
+			wantFields: []string{"bytes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Errorf("Compile() error = %v, no error expected", err)
+				return
+			}
+			nodes := pq.FindNodes(tt.root)
+			paths := []string{}
+			values := []any{}
+			fields := []string{}
+			for _, node := range nodes {
+				paths = append(paths, node.Path())
+				values = append(values, node.Interface())
+				field := ""
+				if node.Descriptor() != nil {
+					field = string(node.Descriptor().Name())
+				}
+				fields = append(fields, field)
+			}
+			if !deepEqual(paths, tt.wantPaths) {
+				t.Errorf("FindNodes() paths = %+v, want %+v", paths, tt.wantPaths)
+			}
+			if !deepEqual(values, tt.wantValues) {
+				t.Errorf("FindNodes() values = %+v, want %+v", values, tt.wantValues)
+			}
+			if !deepEqual(fields, tt.wantFields) {
+				t.Errorf("FindNodes() fields = %+v, want %+v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestNodePathRoundTrip(t *testing.T) {
+	msg := &proto.MessageWithMap{
+		StringStringMap: map[string]string{
+			"plain":     "v1",
+			"it's":      "v2",
+			`say "hi"`:  "v3",
+			`it's "hi"`: "v4",
+			`''`:        "v5",
+			`"it''s"`:   "v6",
+		},
+	}
+
+	pq, err := Compile("/string_string_map[$k]")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	for key, want := range msg.StringStringMap {
+		nodes := pq.FindNodes(msg, Bind("k", key))
+		if len(nodes) != 1 {
+			t.Fatalf("FindNodes(%q) = %d nodes, want 1", key, len(nodes))
+		}
+		path := nodes[0].Path()
+		npq, err := Compile(path)
+		if err != nil {
+			t.Errorf("Compile(%q) error = %v, no error expected", path, err)
+			continue
+		}
+		if res := npq.FindAll(msg); !deepEqual(res, []any{want}) {
+			t.Errorf("FindAll(%q) = %+v, want %+v", path, res, []any{want})
+		}
+	}
+
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "The Go Programming Language"},
+		},
+	}
+	for _, query := range []string{
+		"/books[0]/title[1:-1:3]",
+		"/books[0]/title[::-5]",
+		"/books[0]/title[5:1:-1]",
+		"/books[0]/title[-1:5]",
+	} {
+		pq, err := Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v, no error expected", query, err)
+		}
+		nodes := pq.FindNodes(store)
+		if len(nodes) != 1 {
+			t.Fatalf("FindNodes(%q) = %d nodes, want 1", query, len(nodes))
+		}
+		path := nodes[0].Path()
+		npq, err := Compile(path)
+		if err != nil {
+			t.Errorf("Compile(%q) error = %v, no error expected", path, err)
+			continue
+		}
+		want := []any{nodes[0].Interface()}
+		if res := npq.FindAll(store); !deepEqual(res, want) {
+			t.Errorf("FindAll(%q) = %+v, want %+v", path, res, want)
+		}
+	}
+}
+
+func TestNodeValueEnum(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:   "John",
+				Phones: []*proto.Person_PhoneNumber{{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK}},
+			},
+		},
+	}
+	pq, err := Compile("/people[0]/phones[0]/type")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	nodes := pq.FindNodes(ab)
+	if len(nodes) != 1 {
+		t.Fatalf("FindNodes() = %d nodes, want 1", len(nodes))
+	}
+	node := nodes[0]
+	if got := node.Interface(); got != "PHONE_TYPE_WORK" {
+		t.Errorf("Interface() = %v, want %v", got, "PHONE_TYPE_WORK")
+	}
+	phone := &proto.Person_PhoneNumber{}
+	phone.ProtoReflect().Set(node.Descriptor(), node.Value())
+	if phone.Type != proto.PhoneType_PHONE_TYPE_WORK {
+		t.Errorf("Set(Value()) type = %v, want %v", phone.Type, proto.PhoneType_PHONE_TYPE_WORK)
+	}
+}
+
+func TestFindNodesParent(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+			},
+		},
+	}
+	pq, err := Compile("/people/phones/number")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	nodes := pq.FindNodes(ab)
+	if len(nodes) != 1 {
+		t.Fatalf("FindNodes() returned %d nodes, want 1", len(nodes))
+	}
+	node := nodes[0]
+	if got := node.Parent().Interface(); got != ab.People[0].Phones[0] {
+		t.Fatalf("Node.Parent() = %+v, want %+v", got, ab.People[0].Phones[0])
+	}
+	// The node carries enough information to write the value back.
+	node.Parent().Set(node.Descriptor(), protoreflect.ValueOfString("654321"))
+	if got := ab.People[0].Phones[0].Number; got != "654321" {
+		t.Fatalf("Number = %q, want %q", got, "654321")
+	}
+}
+
+func TestFindAllParentAxis(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "Bob",
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantPaths  []string
+		wantValues []any
+	}{
+		{
+			name:      "parent of a filtered list",
+			query:     "/people/phones[@type='PHONE_TYPE_WORK']/..",
+			wantPaths: []string{"/people[1]"},
+		},
+		{
+			name:       "parent sibling",
+			query:      "/people/phones[@type='PHONE_TYPE_WORK']/../name",
+			wantPaths:  []string{"/people[1]/name"},
+			wantValues: []any{"John"},
+		},
+		{
+			name:      "empty lists have no parent",
+			query:     "/people/phones/..",
+			wantPaths: []string{"/people[0]", "/people[1]"},
+		},
+		{
+			name:      "parent of a scalar",
+			query:     "/people/name/..",
+			wantPaths: []string{"/people[0]", "/people[1]", "/people[2]"},
+		},
+		{
+			name:       "grandparent is visited once",
+			query:      "/people/phones/../../people[0]/name",
+			wantPaths:  []string{"/people[0]/name"},
+			wantValues: []any{"Alice"},
+		},
+		{
+			name:      "root has no parent",
+			query:     "/..",
+			wantPaths: []string{},
+		},
+		{
+			name:       "parent attribute in a predicate",
+			query:      "/people/phones[../@name = 'John']/number",
+			wantPaths:  []string{"/people[1]/phones[0]/number", "/people[1]/phones[1]/number"},
+			wantValues: []any{"223456", "223458"},
+		},
+		{
+			name:       "parent attribute presence in a predicate",
+			query:      "/people/phones[../@name]/number",
+			wantPaths:  []string{"/people[0]/phones[0]/number", "/people[1]/phones[0]/number", "/people[1]/phones[1]/number"},
+			wantValues: []any{"123456", "223456", "223458"},
+		},
+		{
+			name:       "parent path in a predicate",
+			query:      "/people/phones[(../../people[2]/name = 'Bob') && @type = 'PHONE_TYPE_WORK']/number",
+			wantPaths:  []string{"/people[1]/phones[1]/number"},
+			wantValues: []any{"223458"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			paths := []string{}
+			values := []any{}
+			for _, node := range pq.FindNodes(ab) {
+				paths = append(paths, node.Path())
+				if tt.wantValues != nil {
+					values = append(values, node.Interface())
+				}
+			}
+			if !deepEqual(paths, tt.wantPaths) {
+				t.Errorf("FindNodes() paths = %+v, want %+v", paths, tt.wantPaths)
+			}
+			if tt.wantValues != nil && !deepEqual(values, tt.wantValues) {
+				t.Errorf("FindNodes() values = %+v, want %+v", values, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestFindAllRelativePaths(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+				LastUpdated: &timestamppb.Timestamp{Seconds: 1700000000},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_HOME},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "Bob",
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "sub-path comparison",
+			query: "/people[phones/type = 'PHONE_TYPE_WORK']/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "sub-path inequality matches any element",
+			query: "/people[phones/type != 'PHONE_TYPE_WORK']/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "sub-path with a predicate is truthy when non-empty",
+			query: "/people[phones[@type='PHONE_TYPE_MOBILE']]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "sub-path presence",
+			query: "/people[phones]/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "sub-path absence",
+			query: "/people[!phones]/name",
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "negated sub-path in a compound predicate",
+			query: "/people[!phones[@type = 'PHONE_TYPE_WORK'] && @name != 'Bob']/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "sub-path in a compound predicate",
+			query: "/people[(phones/number = '223456') && @name = 'John']/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "self-relative sub-path",
+			query: "/people[./phones/number = '123456']/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "dotted property access",
+			query: "/people[@last_updated.seconds > 0]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "dotted property presence",
+			query: "/people[@last_updated.seconds]/name",
+			want:  []any{"Alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(ab)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllAbsolutePaths(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Boss",
+				Id:   1,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "100", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "Alice",
+				Id:   2,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "200", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "100", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "John",
+				Id:   3,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "300", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{
+			name:  "attribute step",
+			query: "/people/@name",
+			want:  []any{"Boss", "Alice", "John"},
+		},
+		{
+			name:  "join on an absolute path",
+			query: "/people[@name != 'Boss'][phones/number = /people[@name='Boss']/phones/number]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "absolute path attribute",
+			query: "/people[@id > /people[@name='Boss']/@id]/name",
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:  "root variable",
+			query: "/people[@id = $root/people[2]/@id]/name",
+			want:  []any{"John"},
+		},
+		{
+			name:  "root variable presence",
+			query: "/people[$root][0]/name",
+			want:  []any{"Boss"},
+		},
+		{
+			name:  "absolute recursive descent",
+			query: "/people[(//number = '300') && @id = 1]/name",
+			want:  []any{"Boss"},
+		},
+		{
+			name:  "absolute path in a nested predicate",
+			query: "/people/phones[@number = $root/people[0]/phones[0]/@number]/../name",
+			want:  []any{"Boss", "Alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res := pq.FindAll(ab)
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllSetOperators(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:  "Alice",
+				Email: "alice@example.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+				},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		opts      []FindOption
+		wantPaths []string
+		wantErr   error
+	}{
+		{
+			name:      "union in document order",
+			query:     "/people/email | /people/name",
+			wantPaths: []string{"/people[0]/name", "/people[0]/email", "/people[1]/name", "/people[1]/email"},
+		},
+		{
+			name:      "union is deduplicated",
+			query:     "/people[@name='John']/name | /people/name",
+			wantPaths: []string{"/people[0]/name", "/people[1]/name"},
+		},
+		{
+			name:      "union of a parent and a child",
+			query:     "/people/phones[@type='PHONE_TYPE_WORK']/number | /people[1]",
+			wantPaths: []string{"/people[1]", "/people[1]/phones[1]/number"},
+		},
+		{
+			name:      "intersect",
+			query:     "/people/phones/number intersect //phones[@type='PHONE_TYPE_MOBILE']/number",
+			wantPaths: []string{"/people[0]/phones[0]/number", "/people[1]/phones[0]/number"},
+		},
+		{
+			name:      "except",
+			query:     "/people/phones except /people/phones[@type='PHONE_TYPE_MOBILE']",
+			wantPaths: []string{"/people[1]/phones[1]"},
+		},
+		{
+			name:      "except binds tighter than union",
+			query:     "/people/name | /people/phones except /people/phones[@type='PHONE_TYPE_MOBILE']",
+			wantPaths: []string{"/people[0]/name", "/people[1]/name", "/people[1]/phones[1]"},
+		},
+		{
+			name:      "parentheses",
+			query:     "(/people/name | /people/phones) except /people/phones[@type='PHONE_TYPE_MOBILE']",
+			wantPaths: []string{"/people[0]/name", "/people[1]/name", "/people[1]/phones[1]"},
+		},
+		{
+			name:      "max results",
+			query:     "/people/email | /people/name",
+			opts:      []FindOption{WithMaxResults(3)},
+			wantPaths: []string{"/people[0]/name", "/people[0]/email", "/people[1]/name"},
+		},
+		{
+			name:    "limits apply to every path",
+			query:   "/people/email | //number",
+			opts:    []FindOption{WithMaxDepth(1)},
+			wantErr: ErrLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			paths := []string{}
+			err = pq.walk(context.Background(), ab, func(qi queueItem) bool {
+				paths = append(paths, Node{item: qi}.Path())
+				return true
+			}, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("walk() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("walk() error = %v, no error expected", err)
+			}
+			if !deepEqual(paths, tt.wantPaths) {
+				t.Errorf("walk() paths = %+v, want %+v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{Name: "Alice", Email: "alice@example.com", Phones: []*proto.Person_PhoneNumber{{Number: "1"}, {Number: "2"}}},
+			{Name: "John", Email: "john@example.com"},
+		},
+	}
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "A", Price: 10, Pages: 100},
+			{Title: "B", Price: 20, Pages: 300},
+			{Title: "C", Price: 30, Pages: 200},
+		},
+	}
+	prices := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "A", Price: 10.5},
+			{Title: "B", Price: 20.1},
+		},
+	}
+	scalars := &proto.ScalarsHolder{
+		Items: []*proto.Scalars{
+			{Int64Field: math.MinInt64, Uint64Field: math.MaxUint64},
+			{Int64Field: 1, Uint64Field: 1},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		opts     []CompileOption
+		msg      protoreflect.ProtoMessage
+		want     any
+		wantType Type
+		wantErr  error
+	}{
+		{
+			name:     "count",
+			query:    "count(/people)",
+			msg:      ab,
+			want:     int64(2),
+			wantType: TypeInt,
+		},
+		{
+			name:     "relative path",
+			query:    "count(people/phones)",
+			msg:      ab,
+			want:     int64(2),
+			wantType: TypeInt,
+		},
+		{
+			name:     "average price",
+			query:    "sum(/books/price) / count(/books)",
+			msg:      store,
+			want:     float64(20),
+			wantType: TypeFloat,
+		},
+		{
+			name:     "float32 sum",
+			query:    "sum(/books/price)",
+			msg:      prices,
+			want:     float64(30.6),
+			wantType: TypeFloat,
+		},
+		{
+			name:     "float32 average",
+			query:    "avg(/books/price)",
+			msg:      prices,
+			want:     float64(15.3),
+			wantType: TypeFloat,
+		},
+		{
+			name:     "float32 minimum",
+			query:    "min(/books/price)",
+			msg:      prices,
+			want:     float64(10.5),
+			wantType: TypeFloat,
+		},
+		{
+			name:     "integer sum",
+			query:    "sum(/items/int64_field)",
+			msg:      scalars,
+			want:     int64(math.MinInt64 + 1),
+			wantType: TypeInt,
+		},
+		{
+			name:     "unsigned maximum",
+			query:    "max(/items/uint64_field)",
+			msg:      scalars,
+			want:     uint64(math.MaxUint64),
+			wantType: TypeUint,
+		},
+		{
+			name:     "empty sum",
+			query:    "sum(/books[@pages > 1000]/pages)",
+			msg:      store,
+			want:     int64(0),
+			wantType: TypeInt,
+		},
+		{
+			name:     "string concatenation",
+			query:    "/people[0]/name + ' <' + /people[0]/email + '>'",
+			msg:      ab,
+			want:     "Alice <alice@example.com>",
+			wantType: TypeString,
+		},
+		{
+			name:     "xpath positions",
+			query:    "/people[2]/name + ''",
+			opts:     []CompileOption{WithXPathPositions()},
+			msg:      ab,
+			want:     "John",
+			wantType: TypeString,
+		},
+		{
+			name:     "condition",
+			query:    "max(/books/pages) > 250",
+			msg:      store,
+			want:     true,
+			wantType: TypeBool,
+		},
+		{
+			name:     "unset value",
+			query:    "/people[5]/name + ''",
+			msg:      ab,
+			want:     nil,
+			wantType: TypeNodeSet,
+		},
+		{
+			name:     "path query",
+			query:    "/books[@price > 15]/title",
+			msg:      store,
+			want:     []string{"/books[1]/title", "/books[2]/title"},
+			wantType: TypeNodeSet,
+		},
+		{
+			name:     "left-associative subtraction",
+			query:    "max(/books/pages) - 100 - 50",
+			msg:      store,
+			want:     int64(150),
+			wantType: TypeInt,
+		},
+		{
+			name:     "multiplication precedence",
+			query:    "2 * count(/books) + 1",
+			msg:      store,
+			want:     int64(7),
+			wantType: TypeInt,
+		},
+		{
+			name:     "membership",
+			query:    "count(/books[@pages in (100, 200)]) = 2 && count(/books) = 3",
+			msg:      store,
+			want:     true,
+			wantType: TypeBool,
+		},
+		{
+			name:     "integer division",
+			query:    "/books[0]/pages / 3",
+			msg:      store,
+			want:     int64(33),
+			wantType: TypeInt,
+		},
+		{
+			name:     "float division",
+			query:    "/books[0]/pages / 8.0",
+			msg:      store,
+			want:     float64(12.5),
+			wantType: TypeFloat,
+		},
+		{
+			name:     "modulo",
+			query:    "-7 % 3 + max(/books/pages) % 7",
+			msg:      store,
+			want:     int64(-1 + 300%7),
+			wantType: TypeInt,
+		},
+		{
+			name:     "float negation",
+			query:    "-/books[1]/price * 2",
+			msg:      store,
+			want:     float64(-40),
+			wantType: TypeFloat,
+		},
+		{
+			name:    "integer division by zero",
+			query:   "/books[0]/pages / (count(/books) - 3)",
+			msg:     store,
+			wantErr: ErrDivisionByZero,
+		},
+		{
+			name:    "float division by zero",
+			query:   "sum(/books/price) / 0",
+			msg:     store,
+			wantErr: ErrDivisionByZero,
+		},
+		{
+			name:    "sum overflow",
+			query:   "sum(/items/uint64_field)",
+			msg:     scalars,
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "modulo by zero",
+			query:   "count(/books) % 0",
+			msg:     store,
+			wantErr: ErrDivisionByZero,
+		},
+		{
+			name:    "overflow",
+			query:   "count(/books) * 9223372036854775807",
+			msg:     store,
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "negation overflow",
+			query:   "-(-9223372036854775807 - count(/people))",
+			msg:     ab,
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "invalid argument",
+			query:   "contains(/books[0]/pages, '1')",
+			msg:     store,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "predicate error in a path",
+			query:   "count(/books[100 / (@pages - 100) > 0])",
+			msg:     store,
+			wantErr: ErrDivisionByZero,
+		},
+		{
+			name:    "unbound variable in a path",
+			query:   "count(/people[@id > $min])",
+			msg:     ab,
+			wantErr: ErrUnboundVariable,
+		},
+		{
+			name:    "unbound variable in a short-circuited operand",
+			query:   "count(/people) < 0 && $min > 0",
+			msg:     ab,
+			wantErr: ErrUnboundVariable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, tt.opts...)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, typ, err := pq.Evaluate(tt.msg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Evaluate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v, no error expected", err)
+			}
+			if typ != tt.wantType {
+				t.Errorf("Evaluate() type = %v, want %v", TypeToStr[typ], TypeToStr[tt.wantType])
+			}
+			if ns, ok := res.(NodeSet); ok {
+				paths := []string{}
+				for _, n := range ns {
+					paths = append(paths, n.Path())
+				}
+				res = paths
+			}
+			if tt.want == nil {
+				if res != nil {
+					t.Errorf("Evaluate() = %+v, want nil", res)
+				}
+				return
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("Evaluate() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllArithmeticErrors(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{Title: "A", Price: 10, Pages: 100},
+			{Title: "B", Price: 4, Pages: 50},
+		},
+	}
+
+	pq, err := Compile("/books[100 / (@pages - 100) < 0]/title")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	// The failing book is skipped unless the evaluation is strict.
+	if res := pq.FindAll(store); !deepEqual(res, []any{"B"}) {
+		t.Errorf("FindAll() = %+v, want %+v", res, []any{"B"})
+	}
+	if _, err := pq.FindAllE(store, WithStrict(true)); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("FindAllE() error = %v, want %v", err, ErrDivisionByZero)
+	}
+
+	pq, err = Compile("/books[@pages % 2 = 0 && @price / 2 < 10]/title")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	if res := pq.FindAll(store); !deepEqual(res, []any{"A", "B"}) {
+		t.Errorf("FindAll() = %+v, want %+v", res, []any{"A", "B"})
+	}
+}
+
+func TestEvaluateExpressionQuery(t *testing.T) {
+	pq, err := Compile("count(/people)")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	ab := &proto.AddressBook{People: []*proto.Person{{Name: "Alice"}}}
+	if res := pq.FindAll(ab); len(res) != 0 {
+		t.Fatalf("FindAll() = %+v, want no results", res)
+	}
+	if _, err := pq.FindAllE(ab); err == nil {
+		t.Fatalf("FindAllE() error = nil, want an error")
+	}
+
+	if _, err := Compile("count(/people"); err == nil {
+		t.Fatalf("Compile() error = nil, want an error")
+	}
+
+	pq, err = CompileFor("count(/people) + @nmae", ab.ProtoReflect().Descriptor())
+	if !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf("CompileFor() error = %v, want %v", err, ErrFieldNotFound)
+	}
+}
+
+func TestUserFunctions(t *testing.T) {
+	type ctxKey struct{}
+
+	err := RegisterFunction("is-internal", Signature{
+		Args:    []Type{TypeString},
+		Returns: TypeBool,
+	}, func(ctx context.Context, ectx EvalContext, args []any) (any, error) {
+		return strings.HasSuffix(args[0].(string), "@corp.org"), nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunction() error = %v, no error expected", err)
+	}
+
+	fs := NewFunctionSet()
+	err = fs.Register("country-of", Signature{
+		Args:    []Type{TypeString},
+		Returns: TypeString,
+	}, func(ctx context.Context, ectx EvalContext, args []any) (any, error) {
+		if strings.HasPrefix(args[0].(string), "+44") {
+			return "GB", nil
+		}
+		return "US", nil
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v, no error expected", err)
+	}
+	err = fs.Register("tenant", Signature{
+		Returns: TypeString,
+	}, func(ctx context.Context, ectx EvalContext, args []any) (any, error) {
+		tenant, _ := ctx.Value(ctxKey{}).(string)
+		return tenant, nil
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v, no error expected", err)
+	}
+	err = fs.Register("phone-count", Signature{
+		Args:    []Type{TypeNodeSet},
+		Returns: TypeInt,
+	}, func(ctx context.Context, ectx EvalContext, args []any) (any, error) {
+		ns, _ := args[0].(NodeSet)
+		return int64(len(ns)), nil
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v, no error expected", err)
+	}
+
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:   "Alice",
+				Email:  "alice@corp.org",
+				Phones: []*proto.Person_PhoneNumber{{Number: "+1-555-0100"}},
+			},
+			{
+				Name:   "John",
+				Email:  "john@example.com",
+				Phones: []*proto.Person_PhoneNumber{{Number: "+44-555-0200"}, {Number: "+44-555-0201"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []CompileOption
+		ctx     context.Context
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "global function",
+			query: "/people[is-internal(@email)]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "function set",
+			query: "/people/phones[country-of(@number) = 'GB']/number",
+			opts:  []CompileOption{WithFunctions(fs)},
+			want:  []any{"+44-555-0200", "+44-555-0201"},
+		},
+		{
+			name:  "node set argument",
+			query: "/people[phone-count(phones) > 1]/name",
+			opts:  []CompileOption{WithFunctions(fs)},
+			want:  []any{"John"},
+		},
+		{
+			name:  "evaluation context",
+			query: "/people[tenant() = 'corp']/name",
+			opts:  []CompileOption{WithFunctions(fs)},
+			ctx:   context.WithValue(context.Background(), ctxKey{}, "corp"),
+			want:  []any{"Alice", "John"},
+		},
+		{
+			name:    "function set is not available without the option",
+			query:   "/people[country-of(@email) = 'GB']",
+			wantErr: ErrUnknownFunction,
+		},
+		{
+			name:    "unknown function",
+			query:   "/people[is-external(@email)]",
+			wantErr: ErrUnknownFunction,
+		},
+		{
+			name:    "argument count mismatch",
+			query:   "/people[is-internal(@email, @name)]",
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:    "literal argument type mismatch",
+			query:   "/people[is-internal(1)]",
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "built-in argument count mismatch",
+			query:   "/people[contains(@name)]",
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:    "built-in argument type mismatch",
+			query:   "/people[contains(@name, string-length(@name))]",
+			wantErr: ErrInvalidType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Compile() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			res, err := pq.FindAllContext(ctx, ab, WithStrict(true))
+			if err != nil {
+				t.Fatalf("FindAllContext() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllContext() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFunctionErrors(t *testing.T) {
+	impl := func(context.Context, EvalContext, []any) (any, error) { return nil, nil }
+	tests := []struct {
+		name    string
+		fname   string
+		sig     Signature
+		impl    FunctionImpl
+		wantErr error
+	}{
+		{
+			name:    "built-in function",
+			fname:   "contains",
+			impl:    impl,
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:    "invalid name",
+			fname:   "is internal",
+			impl:    impl,
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:    "no implementation",
+			fname:   "noop",
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:    "variadic without arguments",
+			fname:   "noop",
+			sig:     Signature{Variadic: true},
+			impl:    impl,
+			wantErr: ErrInvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewFunctionSet().Register(tt.fname, tt.sig, tt.impl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserFunctionReturns(t *testing.T) {
+	fs := NewFunctionSet()
+	register := func(name string, returns Type, v any) {
+		err := fs.Register(name, Signature{Returns: returns}, func(context.Context, EvalContext, []any) (any, error) {
+			return v, nil
+		})
+		if err != nil {
+			t.Fatalf("Register() error = %v, no error expected", err)
+		}
+	}
+	register("small-id", TypeInt, int32(1))
+	register("enum-name", TypeEnum, "PHONE_TYPE_WORK")
+	register("string-id", TypeInt, "1")
+	register("nil-name", TypeString, nil)
+
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:   "Alice",
+				Id:     1,
+				Phones: []*proto.Person_PhoneNumber{{Number: "123", Type: proto.PhoneType_PHONE_TYPE_WORK}},
+			},
+			{
+				Name: "John",
+				Id:   2,
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "normalized integer",
+			query: "/people[@id = small-id()]/name",
+			want:  []any{"Alice"},
+		},
+		{
+			name:  "enum name",
+			query: "/people/phones[@type = enum-name()]/number",
+			want:  []any{"123"},
+		},
+		{
+			name:    "return type mismatch",
+			query:   "/people[@id = string-id()]/name",
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "nil return",
+			query:   "/people[@name = nil-name()]/name",
+			wantErr: ErrInvalidType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query, WithFunctions(fs))
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(ab, WithStrict(true))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllVariables(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Id:   1,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "John",
+				Id:   2,
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "224", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "Bob",
+				Id:   3,
+			},
+		},
+	}
+	names, err := Compile("/people[@id > 1]/name")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "string variables",
+			query: "/people[@name = $name]/phones[@type = $t]/number",
+			opts:  []FindOption{Bind("name", "John"), Bind("t", "PHONE_TYPE_WORK")},
+			want:  []any{"224"},
+		},
+		{
+			name:  "enum variable",
+			query: "/people/phones[@type = $t]/number",
+			opts:  []FindOption{Bind("t", proto.PhoneType_PHONE_TYPE_MOBILE)},
+			want:  []any{"223"},
+		},
+		{
+			name:  "int variable",
+			query: "/people[@id > $id]/name",
+			opts:  []FindOption{Bind("id", 2)},
+			want:  []any{"Bob"},
+		},
+		{
+			name:  "index variable",
+			query: "/people[$i]/name",
+			opts:  []FindOption{Bind("i", uint8(1))},
+			want:  []any{"John"},
+		},
+		{
+			name:  "quotes are not interpreted",
+			query: "/people[@name = $name]/name",
+			opts:  []FindOption{Bind("name", "x' || '1' = '1")},
+			want:  []any{},
+		},
+		{
+			name:  "list variable",
+			query: "/people[@name = $names]/id",
+			opts:  []FindOption{Bind("names", []string{"Alice", "Bob"})},
+			want:  []any{int32(1), int32(3)},
+		},
+		{
+			name:  "empty list variable",
+			query: "/people[@name = $names]/id",
+			opts:  []FindOption{Bind("names", []string{})},
+			want:  []any{},
+		},
+		{
+			name:  "aggregate over a list variable",
+			query: "/people[@id = max($ids)]/name",
+			opts:  []FindOption{Bind("ids", []int64{1, 2})},
+			want:  []any{"John"},
+		},
+		{
+			name:  "node set variable",
+			query: "/people[@name = $names]/id",
+			opts:  []FindOption{Bind("names", names.FindNodes(ab))},
+			want:  []any{int32(2), int32(3)},
+		},
+		{
+			name:    "type mismatch",
+			query:   "/people[@name > $id]/name",
+			opts:    []FindOption{Bind("id", 1)},
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "unbound variable",
+			query:   "/people[@name = $name]/name",
+			wantErr: ErrUnboundVariable,
+		},
+		{
+			name:    "unbound variable in a short-circuited operand",
+			query:   "/people[@id < 0 && @name = $name]/name",
+			wantErr: ErrUnboundVariable,
+		},
+		{
+			name:    "unsupported value",
+			query:   "/people[@name = $name]/name",
+			opts:    []FindOption{Bind("name", struct{}{})},
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "reserved name",
+			query:   "/people/name",
+			opts:    []FindOption{Bind("root", "x")},
+			wantErr: ErrInvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(ab, append(tt.opts, WithStrict(true))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+
+	// The same compiled query is reused with different bindings.
+	pq, err := Compile("/people[@name = $name]/id")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	for name, want := range map[string][]any{"Alice": {int32(1)}, "Bob": {int32(3)}} {
+		if res := pq.FindAll(ab, Bind("name", name)); !deepEqual(res, want) {
+			t.Errorf("FindAll() = %+v, want %+v", res, want)
+		}
+	}
+
+	pq, err = Compile("count(/people) > $n")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+	if res, _, err := pq.Evaluate(ab, Bind("n", 2)); err != nil || res != true {
+		t.Errorf("Evaluate() = %v, %v, want true", res, err)
+	}
+}
+
+func TestUnboundVariablePanics(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{{Name: "Alice"}},
+	}
+	pq, err := Compile("/people[@name = $name]/name")
+	if err != nil {
+		t.Fatalf("Compile() error = %v, no error expected", err)
+	}
+
+	tests := []struct {
+		name string
+		call func()
+	}{
+		{name: "FindAll", call: func() { pq.FindAll(ab) }},
+		{name: "FindNodes", call: func() { pq.FindNodes(ab) }},
+		{name: "FindFirst", call: func() { pq.FindFirst(ab) }},
+		{name: "Exists", call: func() { pq.Exists(ab) }},
+		{name: "Count", call: func() { pq.Count(ab) }},
+		{name: "Walk", call: func() { pq.Walk(ab, func(any) bool { return true }) }},
+		{name: "All", call: func() {
+			for range pq.All(ab) {
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrUnboundVariable) {
+					t.Errorf("%v() panic = %v, want %v", tt.name, err, ErrUnboundVariable)
+				}
+			}()
+			tt.call()
+		})
+	}
+
+	// The bound variables do not panic.
+	if res := pq.FindAll(ab, Bind("name", "Alice")); !deepEqual(res, []any{"Alice"}) {
+		t.Errorf("FindAll() = %+v, want %+v", res, []any{"Alice"})
+	}
+}
+
+func TestFindAllE(t *testing.T) {
+	store := &proto.Bookstore{
+		Books: []*proto.Book{
+			{
+				Title:  "The Go Programming Language",
 				Author: "Alan A. A. Donovan",
 				Price:  34.99,
 			},
@@ -739,34 +4098,85 @@ func TestFindAllWildcard(t *testing.T) {
 	}
 
 	tests := []struct {
-		name  string
-		query string
-		want  []any
+		name         string
+		query        string
+		strict       bool
+		want         []any
+		wantErr      error
+		wantPath     string
+		wantWarnings int
 	}{
 		{
-			name:  "select all books",
-			query: "/*",
-			want:  []any{store.Books[0], store.Books[1], store.Books[2]},
+			name:   "unset properties are not errors",
+			query:  "/books[@price > 35]/title",
+			strict: true,
+			want:   []any{"The Rust Programming Language"},
 		},
 		{
-			name:  "select all book properties",
-			query: "/books[0]/*",
-			want: []any{
-				"The Go Programming Language",
-				"Alan A. A. Donovan",
-				float32(34.99),
-				int32(0),
-				false,
-			},
+			name:     "unknown field in strict mode",
+			query:    "/books[@prce > 10]",
+			strict:   true,
+			wantErr:  ErrFieldNotFound,
+			wantPath: "/books[0]",
 		},
 		{
-			name:  "select all properties of all books",
-			query: "/*/*",
-			want: []any{
-				"The Go Programming Language", "Alan A. A. Donovan", float32(34.99), int32(0), false,
-				"The Rust Programming Language", "Steve Klabnik", float32(39.99), int32(0), false,
-				"The Bible", "", float32(0.00), int32(0), false,
-			},
+			name:         "unknown field in lenient mode",
+			query:        "/books[@prce > 10]",
+			want:         []any{},
+			wantWarnings: 3,
+		},
+		{
+			name:     "unknown presence field in strict mode",
+			query:    "/books[@prce]",
+			strict:   true,
+			wantErr:  ErrFieldNotFound,
+			wantPath: "/books[0]",
+		},
+		{
+			name:     "unknown node in strict mode",
+			query:    "/books/prce",
+			strict:   true,
+			wantErr:  ErrFieldNotFound,
+			wantPath: "/books[0]",
+		},
+		{
+			name:         "unknown node in lenient mode",
+			query:        "/books/prce",
+			want:         []any{},
+			wantWarnings: 3,
+		},
+		{
+			name:     "unknown node in a sub-path in strict mode",
+			query:    "/books[../boks/title = 'The Bible']",
+			strict:   true,
+			wantErr:  ErrFieldNotFound,
+			wantPath: "/books[0]",
+		},
+		{
+			name:   "unknown node after a wildcard is not an error",
+			query:  "/*/prce",
+			strict: true,
+			want:   []any{},
+		},
+		{
+			name:     "type mismatch in strict mode",
+			query:    "/books[position() > true]",
+			strict:   true,
+			wantErr:  ErrTypeMismatch,
+			wantPath: "/books[0]",
+		},
+		{
+			name:     "unsupported key in strict mode",
+			query:    "/books[0]/price[0]",
+			strict:   true,
+			wantErr:  ErrUnsupportedKey,
+			wantPath: "/books[0]/price",
+		},
+		{
+			name:         "unsupported key in lenient mode",
+			query:        "/books/price[0]",
+			want:         []any{},
+			wantWarnings: 3,
 		},
 	}
 
@@ -774,58 +4184,185 @@ func TestFindAllWildcard(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pq, err := Compile(tt.query)
 			if err != nil {
-				t.Errorf("Compile() error = %v, no error expected", err)
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			var warnings []error
+			res, err := pq.FindAllE(store, WithStrict(tt.strict), WithWarnings(&warnings))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				var everr *EvalError
+				if !errors.As(err, &everr) {
+					t.Fatalf("FindAllE() error = %T, want *EvalError", err)
+				}
+				if everr.Path != tt.wantPath {
+					t.Fatalf("EvalError.Path = %q, want %q", everr.Path, tt.wantPath)
+				}
 				return
 			}
-			res := pq.FindAll(store)
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
 			if !deepEqual(res, tt.want) {
-				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("FindAllE() warnings = %+v, want %d warnings", warnings, tt.wantWarnings)
 			}
 		})
 	}
 }
 
-func TestFindAllFromREADME(t *testing.T) {
-	ab := &proto.AddressBook{
-		People: []*proto.Person{
+func TestFindAllHeterogeneousPredicates(t *testing.T) {
+	holder := &proto.MessageWithMapHolder{
+		MessagesWithMap: []*proto.MessageWithMap{
 			{
-				Name:  "Alice",
-				Email: "alice@corp.com",
-				Phones: []*proto.Person_PhoneNumber{
-					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
-					{Number: "123457", Type: proto.PhoneType_PHONE_TYPE_HOME},
-					{Number: "123458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				StringStringMap: map[string]string{"k": "v"},
+				StringBytesMap:  map[string][]byte{"k": []byte("v")},
+				StringInnerMap: map[string]*proto.MessageWithMap_InnerMessage{
+					"five": {InnerInt: 5, InnerString: "five", InnerArr: []int32{1, 2}},
 				},
-			},
-			{
-				Name:  "John",
-				Email: "john@corp.com",
-				Phones: []*proto.Person_PhoneNumber{
-					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
-					{Number: "223457", Type: proto.PhoneType_PHONE_TYPE_HOME},
-					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				Int32InnerMap: map[int32]*proto.MessageWithMap_InnerMessage{
+					6: {InnerInt: 6, InnerString: "six"},
 				},
 			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []any
+		wantErr error
+	}{
+		{
+			name:  "wildcard after a recursive descent",
+			query: "//*[@inner_int = 5]",
+			want:  []any{},
+		},
+		{
+			name:  "self after a recursive descent",
+			query: "//.[@inner_int = 5]/inner_string",
+			want:  []any{"five"},
+		},
+		{
+			name:  "comparison after a recursive descent",
+			query: "//.[@inner_int > 5]/inner_string",
+			want:  []any{"six"},
+		},
+		{
+			name:  "wildcard over maps and scalars",
+			query: "/messages_with_map/*[@inner_int > 0]",
+			want:  []any{},
+		},
+		{
+			name:    "unknown field without a recursive descent",
+			query:   "/messages_with_map[@inner_int = 5]",
+			wantErr: ErrFieldNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllE(holder, WithStrict(true))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllE() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindAllE() error = %v, no error expected", err)
+			}
+			if !deepEqual(res, tt.want) {
+				t.Errorf("FindAllE() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllContext(t *testing.T) {
+	tree := &proto.Recursion{
+		StringVal: "R",
+		Children: []*proto.Recursion{
 			{
-				Name:  "Bob",
-				Email: "bob@corp.com",
-				Phones: []*proto.Person_PhoneNumber{
-					{Number: "323457", Type: proto.PhoneType_PHONE_TYPE_HOME},
-					{Number: "323458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				StringVal: "A",
+				Children: []*proto.Recursion{
+					{
+						StringVal: "B",
+						Children: []*proto.Recursion{
+							{StringVal: "C"},
+						},
+					},
 				},
 			},
+			{StringVal: "D"},
+			{StringVal: "E"},
 		},
 	}
 
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
 	tests := []struct {
-		name  string
-		query string
-		want  []any
+		name    string
+		ctx     context.Context
+		query   string
+		opts    []FindOption
+		want    []any
+		wantErr error
 	}{
 		{
-			name:  "select first work phone number",
-			query: "/people[@name='John']/phones[@type='PHONE_TYPE_WORK'][0]/number",
-			want:  []any{"223458"},
+			name:  "no limits",
+			ctx:   context.Background(),
+			query: "//string_val",
+			want:  []any{"R", "A", "D", "E", "B", "C"},
+		},
+		{
+			name:    "cancelled context",
+			ctx:     cancelled,
+			query:   "//string_val",
+			wantErr: context.Canceled,
+		},
+		{
+			name:  "max results",
+			ctx:   context.Background(),
+			query: "//string_val",
+			opts:  []FindOption{WithMaxResults(2)},
+			want:  []any{"R", "A"},
+		},
+		{
+			name:    "max visited nodes",
+			ctx:     context.Background(),
+			query:   "//string_val",
+			opts:    []FindOption{WithMaxVisitedNodes(5)},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "max depth",
+			ctx:     context.Background(),
+			query:   "//string_val",
+			opts:    []FindOption{WithMaxDepth(2)},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:  "max depth within limits",
+			ctx:   context.Background(),
+			query: "/children/children/string_val",
+			opts:  []FindOption{WithMaxDepth(3)},
+			want:  []any{"B"},
+		},
+		{
+			name:    "max queue memory",
+			ctx:     context.Background(),
+			query:   "//string_val",
+			opts:    []FindOption{WithMaxQueueMemory(64)},
+			wantErr: ErrLimitExceeded,
 		},
 	}
 
@@ -833,13 +4370,145 @@ func TestFindAllFromREADME(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pq, err := Compile(tt.query)
 			if err != nil {
-				t.Errorf("Compile() error = %v, no error expected", err)
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			res, err := pq.FindAllContext(tt.ctx, tree, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindAllContext() error = %v, want %v", err, tt.wantErr)
+				}
 				return
 			}
-			res := pq.FindAll(ab)
+			if err != nil {
+				t.Fatalf("FindAllContext() error = %v, no error expected", err)
+			}
 			if !deepEqual(res, tt.want) {
-				t.Errorf("FindAll() = %+v, want %+v", res, tt.want)
+				t.Errorf("FindAllContext() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateContext(t *testing.T) {
+	tree := &proto.Recursion{
+		StringVal: "R",
+		Children: []*proto.Recursion{
+			{StringVal: "A", Children: []*proto.Recursion{{StringVal: "B"}}},
+			{StringVal: "C"},
+		},
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		query        string
+		opts         []FindOption
+		want         any
+		wantErr      error
+		wantWarnings int
+	}{
+		{
+			name:  "no limits",
+			ctx:   context.Background(),
+			query: "count(//string_val)",
+			want:  int64(4),
+		},
+		{
+			name:    "cancelled context",
+			ctx:     cancelled,
+			query:   "count(//string_val)",
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "max visited nodes",
+			ctx:     context.Background(),
+			query:   "count(//string_val)",
+			opts:    []FindOption{WithMaxVisitedNodes(3)},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "strict by default",
+			ctx:     context.Background(),
+			query:   "count(/children[@strng_val = 'A'])",
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:         "lenient mode",
+			ctx:          context.Background(),
+			query:        "count(/children[@strng_val = 'A'])",
+			opts:         []FindOption{WithStrict(false)},
+			want:         int64(0),
+			wantWarnings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile() error = %v, no error expected", err)
+			}
+			var warnings []error
+			res, _, err := pq.EvaluateContext(tt.ctx, tree, append(tt.opts, WithWarnings(&warnings))...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("EvaluateContext() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvaluateContext() error = %v, no error expected", err)
+			}
+			if res != tt.want {
+				t.Errorf("EvaluateContext() = %v, want %v", res, tt.want)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("EvaluateContext() warnings = %+v, want %d warnings", warnings, tt.wantWarnings)
 			}
 		})
 	}
 }
+
+// FuzzFindAll makes sure that no query crashes the evaluation.
+func FuzzFindAll(f *testing.F) {
+	for _, q := range []string{
+		"/people[@name = 'John']/phones[@type = 'PHONE_TYPE_WORK']/number",
+		"/people[@id / 0 > 1]",
+		"/people[@id % 0 = 1]",
+		"/people[-@id < 0]/name",
+		"/people[@id in (1, 2)]/name[0:2]",
+		"count(/people) * 9223372036854775807",
+		"/people[last()]/email",
+		"/people[@name =~ '^J']",
+		"/people[contains(@name, 'o')]",
+		"//number",
+		"/people['",
+	} {
+		f.Add(q)
+	}
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name:  "John",
+				Id:    1,
+				Email: "john@example.com",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{Name: "Alice", Id: -2},
+		},
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		if pq, err := Compile(q); err == nil {
+			pq.FindAllE(ab, WithStrict(true), WithMaxVisitedNodes(1000))
+			pq.Evaluate(ab)
+		}
+		if pq, err := CompileFor(q, ab.ProtoReflect().Descriptor()); err == nil {
+			pq.FindAllE(ab, WithMaxVisitedNodes(1000))
+		}
+	})
+}
@@ -13,18 +13,32 @@ const (
 	KeyQueryStepKind
 	RootQueryStepKind
 	RecursiveDescentQueryStepKind
+	ParentQueryStepKind
 )
 
 type Query []QueryStep
 
 func (q Query) String() string {
 	var s strings.Builder
-	for _, step := range q {
+	for i, step := range q {
+		if i > 0 && needsSeparator(q[i-1], step) {
+			s.WriteString("/")
+		}
 		s.WriteString(step.String())
 	}
 	return s.String()
 }
 
+// needsSeparator returns true if the steps should be separated by a slash
+// in the string representation of a query.
+func needsSeparator(prev, next QueryStep) bool {
+	switch prev.Kind() {
+	case RootQueryStepKind, RecursiveDescentQueryStepKind:
+		return false
+	}
+	return next.Kind() != KeyQueryStepKind
+}
+
 type QueryStep interface {
 	Kind() QueryStepKind
 	String() string
@@ -89,9 +103,36 @@ func (qs *RecursiveDescentQueryStep) Kind() QueryStepKind {
 	return RecursiveDescentQueryStepKind
 }
 
+type ParentQueryStep struct {
+	*defaultQueryStep
+}
+
+var _ QueryStep = (*ParentQueryStep)(nil)
+
+func (qs *ParentQueryStep) String() string {
+	return ".."
+}
+
+func (qs *ParentQueryStep) Kind() QueryStepKind {
+	return ParentQueryStepKind
+}
+
+// keyMode is the key step evaluation mode. It is pre-computed for the queries
+// bound to a schema and is resolved in the runtime otherwise.
+type keyMode uint8
+
+const (
+	keyModeDynamic keyMode = iota
+	keyModeFilter
+	keyModeIndex
+	keyModeMapKey
+	keyModeSlice
+)
+
 type KeyQueryStep struct {
 	*defaultQueryStep
 	expr Expression
+	mode keyMode
 }
 
 var _ QueryStep = (*KeyQueryStep)(nil)
@@ -103,3 +144,62 @@ func (qs *KeyQueryStep) String() string {
 func (qs *KeyQueryStep) Kind() QueryStepKind {
 	return KeyQueryStepKind
 }
+
+// SetOperator combines the node sets of two queries.
+type SetOperator uint8
+
+const (
+	_ SetOperator = iota
+	SetUnion
+	SetIntersect
+	SetExcept
+)
+
+var SetOpToStr = map[SetOperator]string{
+	SetUnion:     "|",
+	SetIntersect: "intersect",
+	SetExcept:    "except",
+}
+
+// setOpPrecedence follows XPath: intersect and except bind tighter than union.
+var setOpPrecedence = map[SetOperator]int{
+	SetUnion:     1,
+	SetIntersect: 2,
+	SetExcept:    2,
+}
+
+// QueryTree is a compiled query. A leaf holds a single path, an inner node
+// combines the node sets of the subtrees with a set operator.
+type QueryTree struct {
+	path        Query
+	op          SetOperator
+	left, right *QueryTree
+}
+
+// isPath returns true if the tree is a single path.
+func (t *QueryTree) isPath() bool {
+	return t.op == 0
+}
+
+// paths returns all the tree paths from left to right.
+func (t *QueryTree) paths() []Query {
+	if t.isPath() {
+		return []Query{t.path}
+	}
+	return append(t.left.paths(), t.right.paths()...)
+}
+
+func (t *QueryTree) String() string {
+	if t.isPath() {
+		return t.path.String()
+	}
+	left, right := t.left.String(), t.right.String()
+	// The operators are left-associative.
+	if !t.left.isPath() && setOpPrecedence[t.left.op] < setOpPrecedence[t.op] {
+		left = "(" + left + ")"
+	}
+	if !t.right.isPath() && setOpPrecedence[t.right.op] <= setOpPrecedence[t.op] {
+		right = "(" + right + ")"
+	}
+	return left + " " + SetOpToStr[t.op] + " " + right
+}
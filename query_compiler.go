@@ -4,9 +4,89 @@ import (
 	"fmt"
 )
 
+// compileQueryTree compiles a query combining paths with the set operators,
+// e.g.: `/people/name | /people/email`.
+func compileQueryTree(tokens []*Token) (*QueryTree, error) {
+	tree, ix, err := compileSetExpr(tokens, 0, setOpPrecedence[SetUnion])
+	if err != nil {
+		return nil, err
+	}
+	if ix < len(tokens) {
+		return nil, fmt.Errorf("unexpected token %v %q", tokens[ix].Kind, tokens[ix].Value)
+	}
+	return tree, nil
+}
+
+// compileSetExpr compiles a chain of set operations with the precedence
+// not lower than minPrec.
+func compileSetExpr(tokens []*Token, ix int, minPrec int) (*QueryTree, int, error) {
+	left, ix, err := compileSetOperand(tokens, ix)
+	if err != nil {
+		return nil, ix, err
+	}
+	for {
+		op, ok := matchSetOperator(tokens, ix)
+		if !ok || setOpPrecedence[op] < minPrec {
+			return left, ix, nil
+		}
+		var right *QueryTree
+		right, ix, err = compileSetExpr(tokens, ix+1, setOpPrecedence[op]+1)
+		if err != nil {
+			return nil, ix, err
+		}
+		left = &QueryTree{op: op, left: left, right: right}
+	}
+}
+
+func compileSetOperand(tokens []*Token, ix int) (*QueryTree, int, error) {
+	if matchToken(tokens, ix, TokenLParen) {
+		tree, ix, err := compileSetExpr(tokens, ix+1, setOpPrecedence[SetUnion])
+		if err != nil {
+			return nil, ix, err
+		}
+		if !matchToken(tokens, ix, TokenRParen) {
+			return nil, ix, fmt.Errorf("expected ), got %v", tokenValue(tokens, ix))
+		}
+		return tree, ix + 1, nil
+	}
+	query, ix, err := compilePath(tokens, ix)
+	if err != nil {
+		return nil, ix, err
+	}
+	if len(query) == 0 {
+		return nil, ix, fmt.Errorf("expected path, got %v", tokenValue(tokens, ix))
+	}
+	return &QueryTree{path: query}, ix, nil
+}
+
+// matchSetOperator returns the set operator at the given position.
+func matchSetOperator(tokens []*Token, ix int) (SetOperator, bool) {
+	switch {
+	case matchToken(tokens, ix, TokenPipe):
+		return SetUnion, true
+	case matchToken(tokens, ix, TokenNode) && tokens[ix].Value == "intersect":
+		return SetIntersect, true
+	case matchToken(tokens, ix, TokenNode) && tokens[ix].Value == "except":
+		return SetExcept, true
+	}
+	return 0, false
+}
+
 func compileQuery(tokens []*Token) (Query, error) {
+	query, ix, err := compilePath(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if ix < len(tokens) {
+		return nil, fmt.Errorf("unexpected token %v %q", tokens[ix].Kind, tokens[ix].Value)
+	}
+	return query, nil
+}
+
+// compilePath compiles a single path. It stops at the first token
+// that terminates the path: a set operator or a closing parenthesis.
+func compilePath(tokens []*Token, ix int) (Query, int, error) {
 	var query Query
-	ix := 0
 	for ix < len(tokens) {
 		var err error
 		switch tokens[ix].Kind {
@@ -21,25 +101,45 @@ func compileQuery(tokens []*Token) (Query, error) {
 		case TokenSlashSlash:
 			query = append(query, &RecursiveDescentQueryStep{})
 			ix++
+		case TokenDot:
+			query = append(query, &SelfQueryStep{})
+			ix++
+		case TokenDotDot:
+			query = append(query, &ParentQueryStep{})
+			ix++
 		case TokenNode, TokenStar:
+			// A set operator keyword follows a complete step, a node name follows a separator.
+			if _, ok := matchSetOperator(tokens, ix); ok && len(query) > 0 &&
+				!matchTokenAny(tokens, ix-1, TokenSlash, TokenSlashSlash) {
+				return query, ix, nil
+			}
 			var qs *NodeQueryStep
 			qs, ix, err = compileNodeQueryStep(tokens, ix)
 			if err != nil {
-				return nil, err
+				return nil, ix, err
 			}
 			query = append(query, qs)
+		case TokenAt:
+			// An attribute step is identical to a node step, e.g.: `/people/@name`.
+			if !matchTokenAny(tokens, ix+1, TokenNode, TokenStar) {
+				return nil, ix, fmt.Errorf("expected node or '*', got %v", tokenValue(tokens, ix+1))
+			}
+			query = append(query, &NodeQueryStep{name: tokens[ix+1].Value})
+			ix += 2
 		case TokenLBracket:
 			var qs QueryStep
 			qs, ix, err = compileKeyQueryStep(tokens, ix)
 			if err != nil {
-				return nil, err
+				return nil, ix, err
 			}
 			query = append(query, qs)
+		case TokenPipe, TokenRParen:
+			return query, ix, nil
 		default:
-			return nil, fmt.Errorf("unexpected token %v %q", tokens[ix].Kind, tokens[ix].Value)
+			return nil, ix, fmt.Errorf("unexpected token %v %q", tokens[ix].Kind, tokens[ix].Value)
 		}
 	}
-	return query, nil
+	return query, ix, nil
 }
 
 func compileNodeQueryStep(tokens []*Token, ix int) (*NodeQueryStep, int, error) {
@@ -56,18 +156,131 @@ func compileKeyQueryStep(tokens []*Token, ix int) (*KeyQueryStep, int, error) {
 	var expr Expression
 	var err error
 	if !matchToken(tokens, ix, TokenLBracket) {
-		return nil, ix, fmt.Errorf("expected [, got %v", tokens[ix].Value)
+		return nil, ix, fmt.Errorf("expected [, got %v", tokenValue(tokens, ix))
 	}
 	ix++
-	expr, ix, err = parseExpression(tokens, ix, LOWEST)
+	expr, ix, err = compileKeyExpr(tokens, ix)
 	if err != nil {
 		return nil, ix, err
 	}
 	if !matchToken(tokens, ix, TokenRBracket) {
-		return nil, ix, fmt.Errorf("expected ], got %v", tokens[ix].Value)
+		return nil, ix, fmt.Errorf("expected ], got %v", tokenValue(tokens, ix))
 	}
 	ix++
 	return &KeyQueryStep{
 		expr: expr,
 	}, ix, nil
 }
+
+// compileKeyExpr compiles a key expression or a slice, e.g.: `[1:3]`,
+// `[:5]` or `[::2]`. Every slice bound is optional.
+func compileKeyExpr(tokens []*Token, ix int) (Expression, int, error) {
+	if matchToken(tokens, ix, TokenRBracket) {
+		return nil, ix, fmt.Errorf("expected key expression, got ]")
+	}
+	var bounds [3]Expression
+	var err error
+	for i := range bounds {
+		if i > 0 {
+			if !matchToken(tokens, ix, TokenColon) {
+				break
+			}
+			ix++
+		}
+		if matchTokenAny(tokens, ix, TokenColon, TokenRBracket) {
+			continue
+		}
+		if bounds[i], ix, err = parseExpression(tokens, ix, LOWEST); err != nil {
+			return nil, ix, err
+		}
+		if i == 0 && !matchToken(tokens, ix, TokenColon) {
+			// A plain key expression.
+			return bounds[0], ix, nil
+		}
+	}
+	return NewSliceExpr(bounds[0], bounds[1], bounds[2]), ix, nil
+}
+
+// compileRelativePath compiles a path used as an expression operand, e.g.:
+// `./name`, `../name` or `../@name`. The path stops at the first token that can not
+// continue it, so the slashes of the division operator remain intact.
+func compileRelativePath(tokens []*Token, ix int) (Query, int, error) {
+	var query Query
+	for {
+		switch {
+		case matchToken(tokens, ix, TokenDot):
+			query = append(query, &SelfQueryStep{})
+			ix++
+		case matchToken(tokens, ix, TokenDotDot):
+			query = append(query, &ParentQueryStep{})
+			ix++
+		case matchTokenAny(tokens, ix, TokenNode, TokenStar):
+			var qs *NodeQueryStep
+			var err error
+			qs, ix, err = compileNodeQueryStep(tokens, ix)
+			if err != nil {
+				return nil, ix, err
+			}
+			query = append(query, qs)
+		case matchToken(tokens, ix, TokenAt) && matchTokenAny(tokens, ix+1, TokenNode, TokenStar):
+			// An attribute is a terminal path step.
+			return append(query, &NodeQueryStep{name: tokens[ix+1].Value}), ix + 2, nil
+		default:
+			return nil, ix, fmt.Errorf("expected path step, got %v", tokenValue(tokens, ix))
+		}
+		for matchToken(tokens, ix, TokenLBracket) {
+			var qs *KeyQueryStep
+			var err error
+			qs, ix, err = compileKeyQueryStep(tokens, ix)
+			if err != nil {
+				return nil, ix, err
+			}
+			query = append(query, qs)
+		}
+		if !matchTokenAny(tokens, ix, TokenSlash, TokenSlashSlash) ||
+			!matchTokenAny(tokens, ix+1, TokenDot, TokenDotDot, TokenNode, TokenStar, TokenAt) {
+			return query, ix, nil
+		}
+		if matchToken(tokens, ix, TokenSlashSlash) {
+			query = append(query, &RecursiveDescentQueryStep{})
+		}
+		ix++
+	}
+}
+
+// compileAbsolutePath compiles an absolute path used as an expression operand,
+// e.g.: `/people/@id`, `//number` or `$root/people/@id`.
+func compileAbsolutePath(tokens []*Token, ix int) (Query, int, error) {
+	query := Query{&RootQueryStep{}}
+	switch {
+	case matchToken(tokens, ix, TokenVariable) && tokens[ix].Value == "root":
+		ix++
+		if !matchTokenAny(tokens, ix, TokenSlash, TokenSlashSlash) ||
+			!matchTokenAny(tokens, ix+1, TokenDot, TokenDotDot, TokenNode, TokenStar, TokenAt) {
+			// The root message itself.
+			return query, ix, nil
+		}
+	case matchTokenAny(tokens, ix, TokenSlash, TokenSlashSlash):
+	default:
+		return nil, ix, fmt.Errorf("expected absolute path, got %v", tokenValue(tokens, ix))
+	}
+	if matchToken(tokens, ix, TokenSlashSlash) {
+		query = append(query, &RecursiveDescentQueryStep{})
+	} else if !matchTokenAny(tokens, ix+1, TokenDot, TokenDotDot, TokenNode, TokenStar, TokenAt) {
+		// The root message itself.
+		return query, ix + 1, nil
+	}
+	rel, ix, err := compileRelativePath(tokens, ix+1)
+	if err != nil {
+		return nil, ix, err
+	}
+	return append(query, rel...), ix, nil
+}
+
+// tokenValue returns the token value or EOF if the index is out of range.
+func tokenValue(tokens []*Token, ix int) string {
+	if ix >= len(tokens) {
+		return "EOF"
+	}
+	return tokens[ix].Value
+}
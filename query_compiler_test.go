@@ -141,6 +141,62 @@ func TestCompileQuery(t *testing.T) {
 			},
 			wantErr: fmt.Errorf("unexpected prefix token ]"),
 		},
+		{
+			name: "node with a slice",
+			input: []*Token{
+				NewToken("nodename", TokenNode),
+				NewToken("[", TokenLBracket),
+				NewToken("1", TokenInt),
+				NewToken(":", TokenColon),
+				NewToken("]", TokenRBracket),
+			},
+			want: Query{
+				&NodeQueryStep{name: "nodename"},
+				&KeyQueryStep{
+					expr: &SliceExpr{start: &LiteralExpr{value: int64(1), typ: TypeInt}},
+				},
+			},
+		},
+		{
+			name: "node with a stepped slice",
+			input: []*Token{
+				NewToken("nodename", TokenNode),
+				NewToken("[", TokenLBracket),
+				NewToken(":", TokenColon),
+				NewToken("-", TokenMinus),
+				NewToken("1", TokenInt),
+				NewToken(":", TokenColon),
+				NewToken("2", TokenInt),
+				NewToken("]", TokenRBracket),
+			},
+			want: Query{
+				&NodeQueryStep{name: "nodename"},
+				&KeyQueryStep{
+					expr: &SliceExpr{
+						stop: &UnaryExpr{op: OpMinus, expr: &LiteralExpr{value: int64(1), typ: TypeInt}},
+						step: &LiteralExpr{value: int64(2), typ: TypeInt},
+					},
+				},
+			},
+		},
+		{
+			name: "node with an empty key",
+			input: []*Token{
+				NewToken("nodename", TokenNode),
+				NewToken("[", TokenLBracket),
+				NewToken("]", TokenRBracket),
+			},
+			wantErr: fmt.Errorf("expected key expression, got ]"),
+		},
+		{
+			name: "node with an unterminated key",
+			input: []*Token{
+				NewToken("nodename", TokenNode),
+				NewToken("[", TokenLBracket),
+				NewToken("1", TokenInt),
+			},
+			wantErr: fmt.Errorf("expected ], got EOF"),
+		},
 		{
 			name: "node with an index dereference and an attribute filter",
 			input: []*Token{
@@ -319,6 +375,45 @@ func TestCompileQuery(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "parent step in a path and in a predicate",
+			input: []*Token{
+				NewToken("/", TokenSlash),
+				NewToken("phones", TokenNode),
+				NewToken("[", TokenLBracket),
+				NewToken("..", TokenDotDot),
+				NewToken("/", TokenSlash),
+				NewToken("@", TokenAt),
+				NewToken("name", TokenNode),
+				NewToken("=", TokenEqual),
+				NewToken("John", TokenString),
+				NewToken("]", TokenRBracket),
+				NewToken("/", TokenSlash),
+				NewToken("..", TokenDotDot),
+			},
+			want: Query{
+				&RootQueryStep{},
+				&NodeQueryStep{
+					name: "phones",
+				},
+				&KeyQueryStep{
+					expr: &BinaryExpr{
+						left: &PathExpr{
+							query: Query{
+								&ParentQueryStep{},
+								&NodeQueryStep{name: "name"},
+							},
+						},
+						right: &LiteralExpr{
+							value: "John",
+							typ:   TypeString,
+						},
+						op: OpEq,
+					},
+				},
+				&ParentQueryStep{},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -340,3 +435,85 @@ func TestCompileQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestCompileQueryTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "single path",
+			query: "/people[@name = 'John']/phones",
+			want:  "/people[@name = John]/phones",
+		},
+		{
+			name:  "union",
+			query: "/people/name | /people/email",
+			want:  "/people/name | /people/email",
+		},
+		{
+			name:  "left associative",
+			query: "/a | /b | /c",
+			want:  "/a | /b | /c",
+		},
+		{
+			name:  "intersect binds tighter than union",
+			query: "/a | /b intersect /c",
+			want:  "/a | /b intersect /c",
+		},
+		{
+			name:  "right grouping is preserved",
+			query: "/a | (/b | /c)",
+			want:  "/a | (/b | /c)",
+		},
+		{
+			name:  "lower precedence grouping is preserved",
+			query: "/a intersect (/b | /c)",
+			want:  "/a intersect (/b | /c)",
+		},
+		{
+			name:  "parentheses",
+			query: "(/a | /b) except /c",
+			want:  "(/a | /b) except /c",
+		},
+		{
+			name:  "set operator names are valid field names",
+			query: "/except/intersect",
+			want:  "/except/intersect",
+		},
+		{
+			name:    "missing operand",
+			query:   "/a |",
+			wantErr: fmt.Errorf("expected path, got EOF"),
+		},
+		{
+			name:    "unbalanced parentheses",
+			query:   "(/a | /b",
+			wantErr: fmt.Errorf("expected ), got EOF"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizeXPathQuery(tt.query)
+			if err != nil {
+				t.Fatalf("tokenizeXPathQuery() error = %v, no error expected", err)
+			}
+			got, err := compileQueryTree(tokens)
+			if tt.wantErr != nil {
+				if !errorsSimilar(err, tt.wantErr) {
+					t.Errorf("compileQueryTree() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileQueryTree() error = %v, no error expected", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("compileQueryTree() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
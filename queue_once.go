@@ -20,6 +20,11 @@ func (q *QueueOnce[K, T]) Len() int {
 	return len(q.items)
 }
 
+// MemoLen returns the number of memoized keys.
+func (q *QueueOnce[K, T]) MemoLen() int {
+	return len(q.memo)
+}
+
 // Note: QueueOnce memo is never flushed. This could be a problem if
 // a highamount of items being enqueued and the key cardinality is high.
 func (q *QueueOnce[K, T]) Push(item T) {
@@ -0,0 +1,695 @@
+package protoquery
+
+import (
+	"fmt"
+	"slices"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// CompileFor compiles the query and binds it to the root message descriptor.
+// Unlike Compile, it resolves node steps and property expressions against
+// the schema and type-checks key expressions at compile time. A query that
+// can never match the schema is rejected with an error.
+// The compiled query only matches root messages of the given type.
+func CompileFor(q string, md protoreflect.MessageDescriptor, opts ...CompileOption) (*ProtoQuery, error) {
+	pq, err := Compile(q, opts...)
+	if err != nil {
+		return nil, err
+	}
+	root := dynamicpb.NewMessage(md)
+	start := schemaNode{kind: schemaMessage, md: md}
+	switch {
+	case pq.expr != nil && hasVariables(pq.expr):
+		// The variable types are only known in the runtime, hence only
+		// the paths are bound.
+		ctx := NewEvalContext(root, schemaOptions(start, root)...)
+		for _, p := range outerPathExprs(pq.expr) {
+			if err := bindPathExpr(p, ctx); err != nil {
+				return nil, err
+			}
+		}
+	case pq.expr != nil:
+		if _, err := checkExpr(pq.expr, NewEvalContext(root, schemaOptions(start, root)...)); err != nil {
+			return nil, err
+		}
+	default:
+		for _, path := range pq.tree.paths() {
+			if err := bindQuery(path, []schemaNode{start}, root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	pq.md = md
+	return pq, nil
+}
+
+type schemaKind uint8
+
+const (
+	_ schemaKind = iota
+	schemaMessage
+	schemaList
+	schemaMap
+	schemaBytes
+	schemaScalar
+)
+
+// schemaNode is a static counterpart of the queue item: it describes the type
+// of the values a query step is applied to.
+type schemaNode struct {
+	kind schemaKind
+	// fd is the descriptor of the field holding the value. It is nil for the root.
+	fd protoreflect.FieldDescriptor
+	// md is set for message values.
+	md protoreflect.MessageDescriptor
+	// parents are the nodes of the messages containing the value. The root
+	// has no parents, the nodes selected by a recursive descent might have
+	// several.
+	parents []*schemaNode
+}
+
+func fieldSchemaNode(fd protoreflect.FieldDescriptor) schemaNode {
+	switch {
+	case fd.IsList():
+		return schemaNode{kind: schemaList, fd: fd, md: fd.Message()}
+	case fd.IsMap():
+		return schemaNode{kind: schemaMap, fd: fd}
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		return schemaNode{kind: schemaMessage, fd: fd, md: fd.Message()}
+	case fd.Kind() == protoreflect.BytesKind:
+		return schemaNode{kind: schemaBytes, fd: fd}
+	default:
+		return schemaNode{kind: schemaScalar, fd: fd}
+	}
+}
+
+// elem returns the schema node of the list element.
+func (sn schemaNode) elem() schemaNode {
+	el := fieldSchemaNode(sn.fd)
+	switch {
+	case sn.md != nil:
+		el.kind = schemaMessage
+	case sn.fd.Kind() == protoreflect.BytesKind:
+		el.kind = schemaBytes
+	default:
+		el.kind = schemaScalar
+	}
+	// The list elements share the parent with the list.
+	el.parents = sn.parents
+	return el
+}
+
+// field returns the schema node of the message field. The node must be a
+// message or a list of messages.
+func (sn schemaNode) field(fd protoreflect.FieldDescriptor) schemaNode {
+	parent := sn
+	if sn.kind == schemaList {
+		parent = sn.elem()
+	}
+	node := fieldSchemaNode(fd)
+	node.parents = []*schemaNode{&parent}
+	return node
+}
+
+// mapValue returns the schema node of the map value.
+func (sn schemaNode) mapValue() schemaNode {
+	node := fieldSchemaNode(sn.fd.MapValue())
+	// The map values share the parent with the map.
+	node.parents = sn.parents
+	return node
+}
+
+// newValue returns an empty value of the node type. The value is only used to
+// compute static expression types.
+func (sn schemaNode) newValue() any {
+	switch sn.kind {
+	case schemaMessage:
+		return dynamicpb.NewMessage(sn.md)
+	case schemaList:
+		return dynamicpb.NewMessage(sn.fd.ContainingMessage()).NewField(sn.fd).List()
+	case schemaMap:
+		return dynamicpb.NewMessage(sn.fd.ContainingMessage()).NewField(sn.fd).Map()
+	case schemaScalar:
+		if sn.fd.IsList() {
+			return dynamicpb.NewMessage(sn.fd.ContainingMessage()).NewField(sn.fd).List().NewElement().Interface()
+		}
+		return sn.fd.Default().Interface()
+	default:
+		return nil
+	}
+}
+
+func (sn schemaNode) String() string {
+	if sn.fd == nil {
+		return string(sn.md.FullName())
+	}
+	return string(sn.fd.FullName())
+}
+
+// schemaOptions returns the options of a context used to type-check the
+// expressions applied to the schema node.
+func schemaOptions(node schemaNode, root protoreflect.Message) []EvalOption {
+	return []EvalOption{WithRoot(root), withSchema(node)}
+}
+
+// bindQuery walks the query steps along the message schema starting from the
+// given nodes, validates them and pre-computes the key step modes. The root
+// message is used to bind the absolute paths within the key expressions.
+func bindQuery(query Query, nodes []schemaNode, root protoreflect.Message) error {
+	for _, step := range query {
+		var err error
+		switch step.Kind() {
+		case RootQueryStepKind, SelfQueryStepKind:
+			// The root and self steps do not change the context.
+		case NodeQueryStepKind:
+			nodes, err = bindNodeQueryStep(step.(*NodeQueryStep), nodes)
+		case KeyQueryStepKind:
+			if hasVariables(step.(*KeyQueryStep).expr) {
+				nodes, err = bindVariableKeyQueryStep(step.(*KeyQueryStep), nodes, root)
+			} else {
+				nodes, err = bindKeyQueryStep(step.(*KeyQueryStep), nodes, root)
+			}
+		case ParentQueryStepKind:
+			nodes, err = bindParentQueryStep(nodes)
+		case RecursiveDescentQueryStepKind:
+			nodes = descendants(nodes)
+		default:
+			return fmt.Errorf("step %s: unsupported step kind %v", step, step.Kind())
+		}
+		if err != nil {
+			return fmt.Errorf("step %s: %w", step, err)
+		}
+	}
+	return nil
+}
+
+func bindNodeQueryStep(step *NodeQueryStep, nodes []schemaNode) ([]schemaNode, error) {
+	res := []schemaNode{}
+	for _, node := range nodes {
+		if node.kind != schemaMessage && !(node.kind == schemaList && node.md != nil) {
+			return nil, fmt.Errorf("%w: %s is not a message", ErrFieldNotFound, node)
+		}
+		fields := node.md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if nameMatch(fields.Get(i).Name(), step.name) {
+				res = append(res, node.field(fields.Get(i)))
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrFieldNotFound, step.name)
+	}
+	return res, nil
+}
+
+func bindKeyQueryStep(step *KeyQueryStep, nodes []schemaNode, root protoreflect.Message) ([]schemaNode, error) {
+	res := []schemaNode{}
+	mode := keyModeDynamic
+	for i, node := range nodes {
+		var nodeMode keyMode
+		switch node.kind {
+		case schemaList:
+			enforceBool := isAllPropertyExprs(step.expr)
+			typ, err := step.expr.Type(NewEvalContext(node.newValue(), WithEnforceBool(enforceBool)))
+			if err != nil {
+				return nil, err
+			}
+			el := node.elem()
+			ctx := NewIndexedEvalContext(el.newValue(), 0, append(schemaOptions(el, root), WithEnforceBool(enforceBool))...)
+			switch typ {
+			case TypeBool:
+				if _, err := checkExpr(step.expr, ctx); err != nil {
+					return nil, err
+				}
+				nodeMode = keyModeFilter
+				res = append(res, node)
+			case TypeInt, TypeUint:
+				if _, err := checkExpr(step.expr, NewEvalContext(node.newValue(), schemaOptions(node, root)...)); err != nil {
+					return nil, err
+				}
+				nodeMode = keyModeIndex
+				res = append(res, el)
+			case TypeSlice:
+				if _, err := checkExpr(step.expr, NewEvalContext(node.newValue(), schemaOptions(node, root)...)); err != nil {
+					return nil, err
+				}
+				nodeMode = keyModeSlice
+				res = append(res, node)
+			default:
+				return nil, fmt.Errorf("%w: unsupported list key type %s", ErrUnsupportedKey, TypeToStr[typ])
+			}
+		case schemaMap:
+			typ, err := checkExpr(step.expr, NewEvalContext(node.newValue(), schemaOptions(node, root)...))
+			if err != nil {
+				return nil, err
+			}
+			if !typeFitsKind(typ, node.fd.MapKey().Kind()) {
+				return nil, fmt.Errorf("%w: %s key does not fit map key kind %v", ErrKeyCast, TypeToStr[typ], node.fd.MapKey().Kind())
+			}
+			nodeMode = keyModeMapKey
+			res = append(res, node.mapValue())
+		case schemaBytes:
+			typ, err := checkExpr(step.expr, NewEvalContext(nil, schemaOptions(node, root)...))
+			if err != nil {
+				return nil, err
+			}
+			switch typ {
+			case TypeInt, TypeUint:
+				nodeMode = keyModeIndex
+				res = append(res, schemaNode{kind: schemaScalar, fd: node.fd, parents: node.parents})
+			case TypeSlice:
+				nodeMode = keyModeSlice
+				res = append(res, node)
+			default:
+				return nil, fmt.Errorf("%w: unsupported bytes key type %s", ErrUnsupportedKey, TypeToStr[typ])
+			}
+		case schemaScalar:
+			if node.fd.Kind() != protoreflect.StringKind {
+				return nil, fmt.Errorf("%w: key step is not supported for %s", ErrUnsupportedKey, node)
+			}
+			typ, err := checkExpr(step.expr, NewEvalContext(node.newValue(), schemaOptions(node, root)...))
+			if err != nil {
+				return nil, err
+			}
+			switch typ {
+			case TypeInt, TypeUint:
+				nodeMode = keyModeIndex
+			case TypeSlice:
+				nodeMode = keyModeSlice
+			default:
+				return nil, fmt.Errorf("%w: unsupported string key type %s", ErrUnsupportedKey, TypeToStr[typ])
+			}
+			res = append(res, node)
+		case schemaMessage:
+			if _, err := checkExpr(step.expr, NewEvalContext(node.newValue(), schemaOptions(node, root)...)); err != nil {
+				return nil, err
+			}
+			nodeMode = keyModeFilter
+			res = append(res, node)
+		default:
+			return nil, fmt.Errorf("%w: key step is not supported for %s", ErrUnsupportedKey, node)
+		}
+		if i == 0 {
+			mode = nodeMode
+		} else if mode != nodeMode {
+			mode = keyModeDynamic
+		}
+	}
+	step.mode = mode
+	return res, nil
+}
+
+// bindVariableKeyQueryStep binds the key step referring to the query variables.
+// The variable types are only known in the runtime, hence the key mode is left
+// dynamic and the step selects any value the key could select: a list or a
+// bytes value is either filtered, sliced or indexed, a map is indexed by the
+// key. Only the paths of the key expression are bound.
+func bindVariableKeyQueryStep(step *KeyQueryStep, nodes []schemaNode, root protoreflect.Message) ([]schemaNode, error) {
+	res := []schemaNode{}
+	for _, node := range nodes {
+		el := node
+		switch node.kind {
+		case schemaList:
+			el = node.elem()
+			res = append(res, node, el)
+		case schemaMap:
+			res = append(res, node.mapValue())
+		case schemaBytes:
+			res = append(res, node, schemaNode{kind: schemaScalar, fd: node.fd, parents: node.parents})
+		case schemaMessage:
+			res = append(res, node)
+		case schemaScalar:
+			if node.fd.Kind() != protoreflect.StringKind {
+				return nil, fmt.Errorf("%w: key step is not supported for %s", ErrUnsupportedKey, node)
+			}
+			res = append(res, node)
+		default:
+			return nil, fmt.Errorf("%w: key step is not supported for %s", ErrUnsupportedKey, node)
+		}
+		ctx := NewEvalContext(el.newValue(), schemaOptions(el, root)...)
+		for _, p := range outerPathExprs(step.expr) {
+			if err := bindPathExpr(p, ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	step.mode = keyModeDynamic
+	return res, nil
+}
+
+// bindParentQueryStep returns the nodes of the messages containing the values.
+func bindParentQueryStep(nodes []schemaNode) ([]schemaNode, error) {
+	var parents []schemaNode
+	for _, node := range nodes {
+		for _, parent := range node.parents {
+			parents = append(parents, *parent)
+		}
+	}
+	if len(parents) == 0 {
+		return nil, fmt.Errorf("%w: %s has no parent", ErrFieldNotFound, nodes[0])
+	}
+	return mergeNodes(parents), nil
+}
+
+// descendants returns the nodes a recursive descent selects: the messages
+// themselves and all the messages nested in them, the list elements and the
+// map values included. A message field is only visited once, hence the
+// recursive schemas terminate.
+func descendants(nodes []schemaNode) []schemaNode {
+	seen := map[protoreflect.FieldDescriptor]*schemaNode{}
+	var order, queue []*schemaNode
+	visit := func(node schemaNode) {
+		switch {
+		case node.kind == schemaList && node.md != nil:
+			node = node.elem()
+		case node.kind == schemaMap && node.fd.MapValue().Message() != nil:
+			node = node.mapValue()
+		case node.kind != schemaMessage:
+			return
+		}
+		if sn, ok := seen[node.fd]; ok {
+			sn.parents = mergeParents(sn.parents, node.parents)
+			return
+		}
+		sn := &node
+		seen[node.fd] = sn
+		order = append(order, sn)
+		queue = append(queue, sn)
+	}
+	for _, node := range nodes {
+		visit(node)
+	}
+	for len(queue) > 0 {
+		head := queue[0]
+		queue = queue[1:]
+		fields := head.md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			// The parent is shared, so are the parents merged into it later.
+			node := fieldSchemaNode(fields.Get(i))
+			node.parents = []*schemaNode{head}
+			visit(node)
+		}
+	}
+	res := make([]schemaNode, 0, len(order))
+	for _, sn := range order {
+		res = append(res, *sn)
+	}
+	return res
+}
+
+// mergeNodes deduplicates the nodes of the same field merging their parents.
+func mergeNodes(nodes []schemaNode) []schemaNode {
+	res := make([]schemaNode, 0, len(nodes))
+	ixs := map[protoreflect.FieldDescriptor]int{}
+	for _, node := range nodes {
+		if ix, ok := ixs[node.fd]; ok {
+			res[ix].parents = mergeParents(res[ix].parents, node.parents)
+			continue
+		}
+		ixs[node.fd] = len(res)
+		res = append(res, node)
+	}
+	return res
+}
+
+// mergeParents returns the union of the parent nodes. The parent slices are
+// shared between the nodes, hence the result is always a new slice.
+func mergeParents(a, b []*schemaNode) []*schemaNode {
+	res := slices.Clone(a)
+	for _, p := range b {
+		if !slices.Contains(res, p) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// bindPathExpr binds the path expression to the schema: an absolute path is
+// bound to the root message, a relative one to the context value. The path is
+// left for the runtime if the context schema is not known.
+func bindPathExpr(p *PathExpr, ctx EvalContext) error {
+	var start schemaNode
+	switch {
+	case p.absolute && ctx.Root() != nil:
+		start = schemaNode{kind: schemaMessage, md: ctx.Root().Descriptor()}
+	case !p.absolute && ctx.Options().schema != nil:
+		start = *ctx.Options().schema
+	default:
+		return nil
+	}
+	if err := bindQuery(p.query, []schemaNode{start}, ctx.Root()); err != nil {
+		return fmt.Errorf("path %v: %w", p, err)
+	}
+	return nil
+}
+
+// outerPathExprs returns the path expressions of the expression except the
+// ones nested in the path predicates.
+func outerPathExprs(e Expression) []*PathExpr {
+	var paths []*PathExpr
+	nested := map[*PathExpr]bool{}
+	walkExpr(e, func(e Expression) error {
+		if p, ok := e.(*PathExpr); ok {
+			paths = append(paths, p)
+			walkQueryExprs(p.query, func(e Expression) error {
+				if np, ok := e.(*PathExpr); ok {
+					nested[np] = true
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	res := make([]*PathExpr, 0, len(paths))
+	for _, p := range paths {
+		if !nested[p] {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// hasVariables returns true if the expression refers to the query variables.
+func hasVariables(e Expression) bool {
+	found := false
+	walkExpr(e, func(e Expression) error {
+		if _, ok := e.(*VariableExpr); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// typeFitsKind returns true if a value of the expression type could be cast
+// to the protobuf kind.
+func typeFitsKind(typ Type, kind protoreflect.Kind) bool {
+	switch kind {
+	case protoreflect.BoolKind:
+		return typ == TypeBool
+	case protoreflect.StringKind:
+		return typ == TypeString
+	case protoreflect.BytesKind:
+		return typ == TypeString || typ == TypeBytes
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return isIntegerType(typ)
+	default:
+		return false
+	}
+}
+
+// checkExpr statically type-checks the expression in the given context and
+// binds the property expressions to the field descriptors. Unlike
+// Expression.Type, it validates the operands of the compound expressions.
+func checkExpr(e Expression, ctx EvalContext) (Type, error) {
+	switch ex := e.(type) {
+	case *PropertyExpr:
+		if msg, ok := ctx.This().(protoreflect.Message); ok && ex.name != "*" {
+			target, fd, err := ex.resolve(msg)
+			if err != nil {
+				return TypeUnknown, err
+			}
+			if fd == nil {
+				return TypeUnknown, fmt.Errorf("%w: %v in %v", ErrFieldNotFound, ex.name, target.Descriptor().FullName())
+			}
+			ex.fd = fd
+		}
+		return ex.Type(ctx)
+	case *UnaryExpr:
+		typ, err := checkExpr(ex.expr, ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		switch ex.op {
+		case OpMinus, OpPlus:
+			if !isNumericType(typ) && typ != TypeNodeSet {
+				return TypeUnknown, fmt.Errorf("%w %v for %v operator", ErrInvalidType, TypeToStr[typ], OpToStr[ex.op])
+			}
+		case OpNot:
+			if typ != TypeBool && typ != TypeNodeSet {
+				return TypeUnknown, fmt.Errorf("%w %v for %v operator", ErrInvalidType, TypeToStr[typ], OpToStr[ex.op])
+			}
+		}
+		return ex.Type(ctx)
+	case *BinaryExpr:
+		if ctx.Options().EnforceBool && ex.computesBool() {
+			ctx = ctx.Copy(WithEnforceBool(false))
+		}
+		ltyp, err := checkExpr(ex.left, ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		rtyp, err := checkExpr(ex.right, ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		if !typesCompatible(ltyp, rtyp) {
+			return TypeUnknown, fmt.Errorf("%w(%v Vs %v) in %v", ErrTypeMismatch, TypeToStr[ltyp], TypeToStr[rtyp], ex)
+		}
+		if err := checkOperands(ex, ltyp, rtyp); err != nil {
+			return TypeUnknown, err
+		}
+		return ex.Type(ctx)
+	case *InExpr:
+		ctx = ctx.Copy(WithEnforceBool(false))
+		typ, err := checkExpr(ex.expr, ctx)
+		if err != nil {
+			return TypeUnknown, err
+		}
+		if _, err := checkExpr(ex.list, ctx); err != nil {
+			return TypeUnknown, err
+		}
+		list, ok := ex.list.(*ListExpr)
+		if !ok {
+			return ex.Type(ctx)
+		}
+		if list.typ != TypeUnknown && !typesCompatible(typ, list.typ) {
+			return TypeUnknown, fmt.Errorf("%w(%v Vs %v) in %v", ErrTypeMismatch, TypeToStr[typ], TypeToStr[list.typ], ex)
+		}
+		for _, elem := range list.elems {
+			if err := checkEnumLiteral(ex.expr, elem); err != nil {
+				return TypeUnknown, err
+			}
+		}
+		return ex.Type(ctx)
+	case *PathExpr:
+		if err := bindPathExpr(ex, ctx); err != nil {
+			return TypeUnknown, err
+		}
+		return ex.Type(ctx)
+	case *FunctionCallExpr:
+		if _, err := ex.function(); err != nil {
+			return TypeUnknown, err
+		}
+		for _, arg := range ex.args {
+			if _, err := checkExpr(arg, ctx); err != nil {
+				return TypeUnknown, err
+			}
+		}
+		return ex.Type(ctx)
+	default:
+		return e.Type(ctx)
+	}
+}
+
+// checkOperands validates the binary expression operand types against the
+// operator and the enum literals against the enum values.
+func checkOperands(b *BinaryExpr, ltyp, rtyp Type) error {
+	invalid := func(typ Type) error {
+		if typ == TypeNodeSet {
+			// The type of the node set values is only known in the runtime.
+			return nil
+		}
+		return fmt.Errorf("%w %v for %v operator", ErrInvalidType, TypeToStr[typ], OpToStr[b.op])
+	}
+	switch b.op {
+	case OpAnd, OpOr:
+		if ltyp != TypeBool {
+			return invalid(ltyp)
+		}
+	case OpPlus:
+		if !isNumericType(ltyp) && ltyp != TypeString && !isTimeType(ltyp) {
+			return invalid(ltyp)
+		}
+	case OpLt, OpLe, OpGt, OpGe:
+		if !isNumericType(ltyp) && ltyp != TypeString && ltyp != TypeBytes && !isTimeType(ltyp) {
+			return invalid(ltyp)
+		}
+	case OpMinus:
+		if !isNumericType(ltyp) && !isTimeType(ltyp) {
+			return invalid(ltyp)
+		}
+	case OpMul, OpDiv, OpMod:
+		if !isNumericType(ltyp) {
+			return invalid(ltyp)
+		}
+	case OpMatch:
+		if ltyp != TypeString {
+			return invalid(ltyp)
+		}
+		if rtyp != TypeString {
+			return invalid(rtyp)
+		}
+	case OpEq, OpNe:
+		for _, pair := range [][2]Expression{{b.left, b.right}, {b.right, b.left}} {
+			if err := checkEnumLiteral(pair[0], pair[1]); err != nil {
+				return err
+			}
+		}
+	}
+	if isTimeType(ltyp) || isTimeType(rtyp) {
+		return checkTimeOperands(b, ltyp, rtyp)
+	}
+	return nil
+}
+
+// checkTimeOperands validates the time literals of a binary expression over
+// timestamps and durations, e.g.: `@last_updated > '2024-01-01T00:00:00Z'`.
+func checkTimeOperands(b *BinaryExpr, ltyp, rtyp Type) error {
+	if b.computesBool() {
+		if isTimeType(ltyp) && isTimeType(rtyp) && ltyp != rtyp {
+			return fmt.Errorf("%w(%v Vs %v) in %v", ErrTypeMismatch, TypeToStr[ltyp], TypeToStr[rtyp], b)
+		}
+		if err := checkTimeLiteral(b.right, ltyp); err != nil {
+			return err
+		}
+		return checkTimeLiteral(b.left, rtyp)
+	}
+	// String operands of the time arithmetic are duration literals.
+	if err := checkTimeLiteral(b.left, TypeDuration); err != nil {
+		return err
+	}
+	return checkTimeLiteral(b.right, TypeDuration)
+}
+
+// checkTimeLiteral parses the string literal as a value of the time type.
+func checkTimeLiteral(literal Expression, typ Type) error {
+	lit, ok := literal.(*LiteralExpr)
+	if !ok || lit.typ != TypeString || !isTimeType(typ) {
+		return nil
+	}
+	_, err := timeOperand(lit.value, typ)
+	return err
+}
+
+// checkEnumLiteral validates the string literal compared to the enum property
+// against the enum values.
+func checkEnumLiteral(e, literal Expression) error {
+	prop, ok := e.(*PropertyExpr)
+	if !ok || prop.fd == nil || prop.fd.Enum() == nil {
+		return nil
+	}
+	lit, ok := literal.(*LiteralExpr)
+	if !ok || lit.typ != TypeString {
+		return nil
+	}
+	if prop.fd.Enum().Values().ByName(protoreflect.Name(lit.value.(string))) == nil {
+		return fmt.Errorf("%w: unknown %v value %q", ErrInvalidType, prop.fd.Enum().FullName(), lit.value)
+	}
+	return nil
+}
@@ -0,0 +1,501 @@
+package protoquery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/osdrv/protoquery/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestCompileFor(t *testing.T) {
+	abDescr := (&proto.AddressBook{}).ProtoReflect().Descriptor()
+	mapDescr := (&proto.MessageWithMapHolder{}).ProtoReflect().Descriptor()
+	scalarsDescr := (&proto.RepeatedScalarHolder{}).ProtoReflect().Descriptor()
+	profilesDescr := (&proto.ProfilesHolder{}).ProtoReflect().Descriptor()
+
+	tests := []struct {
+		name      string
+		query     string
+		md        protoreflect.MessageDescriptor
+		wantModes []keyMode
+		wantErr   error
+	}{
+		{
+			name:      "valid query with filters and an index",
+			query:     "/people[@name='John']/phones[@type='PHONE_TYPE_WORK'][0]/number",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter, keyModeFilter, keyModeIndex},
+		},
+		{
+			name:      "presence check",
+			query:     "/people[@email && @name]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:      "index with a builtin",
+			query:     "/people[length() - 1]/name",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeIndex},
+		},
+		{
+			name:      "wildcard",
+			query:     "/*/phones/*",
+			md:        abDescr,
+			wantModes: []keyMode{},
+		},
+		{
+			name:      "map key",
+			query:     "/messages_with_map/string_inner_map['key']/inner_int",
+			md:        mapDescr,
+			wantModes: []keyMode{keyModeMapKey},
+		},
+		{
+			name:      "bytes index",
+			query:     "/items/bytes[0]",
+			md:        scalarsDescr,
+			wantModes: []keyMode{keyModeIndex},
+		},
+		{
+			name:      "negative index",
+			query:     "/people[-1]/name",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeIndex},
+		},
+		{
+			name:      "slices",
+			query:     "/people[1:3]/phones[::2]/number[:2]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeSlice, keyModeSlice, keyModeSlice},
+		},
+		{
+			name:      "bytes slice",
+			query:     "/items/bytes[-2:]",
+			md:        scalarsDescr,
+			wantModes: []keyMode{keyModeSlice},
+		},
+		{
+			name:      "string index",
+			query:     "/people/name[0]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeIndex},
+		},
+		{
+			name:    "invalid slice bound",
+			query:   "/people['a':]",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:      "scalar value filter",
+			query:     "/items/./int32s[. > 1]",
+			md:        scalarsDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "scalar value type mismatch",
+			query:   "/items/strings[. > 1]",
+			md:      scalarsDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:      "string function",
+			query:     "/people[ends-with(@email, '@example.com')]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "string function argument type mismatch",
+			query:   "/people[contains(@id, '1')]",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "string function argument count mismatch",
+			query:   "/people[substring(@name)]",
+			md:      abDescr,
+			wantErr: ErrInvalidArgs,
+		},
+		{
+			name:      "aggregate function",
+			query:     "/people[count(phones) > 2]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:      "variables are resolved in the runtime",
+			query:     "/people[@name = $name]/phones[0]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeDynamic, keyModeIndex},
+		},
+		{
+			name:      "steps after a variable key",
+			query:     "/people[$i]/phones[@type = 'PHONE_TYPE_WORK']/../email",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeDynamic, keyModeFilter},
+		},
+		{
+			name:    "unknown node after a variable key",
+			query:   "/people[$i]/nme",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown node in a variable key path",
+			query:   "/people[phones/tpe = $type]",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:      "variable map key",
+			query:     "/messages_with_map/string_inner_map[$key]/inner_int",
+			md:        mapDescr,
+			wantModes: []keyMode{keyModeDynamic},
+		},
+		{
+			name:      "regular expression match",
+			query:     "/people[@email =~ '@example\\.com$']",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "regular expression match on a non-string",
+			query:   "/people[@id =~ '1']",
+			md:      abDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:      "recursive descent",
+			query:     "//phones[@type = 'PHONE_TYPE_WORK']/number",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "unknown property after a recursive descent",
+			query:   "//people[@nmae]",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown node after a recursive descent",
+			query:   "/people//nme",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:      "parent",
+			query:     "/people/phones/../name",
+			md:        abDescr,
+			wantModes: []keyMode{},
+		},
+		{
+			name:      "parent after a recursive descent",
+			query:     "//number/../..[@name = 'John']",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "unknown node after a parent",
+			query:   "/people/phones/../nme",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "parent of the root",
+			query:   "/people/../..",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown node",
+			query:   "/people/nmae",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "node step on a scalar",
+			query:   "/people/name/first",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown property",
+			query:   "/people[@nmae = 'John']",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown presence property",
+			query:   "/people[@nmae]",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "type mismatch",
+			query:   "/people[@name > 3]",
+			md:      abDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "invalid operand type",
+			query:   "/people[(@name - 'x') = 'y']",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "unknown enum value",
+			query:   "/people/phones[@type = 'PHONE_TYPE_WROK']",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:      "membership",
+			query:     "/people[@id not in (1, 2)]/phones[@type in ('PHONE_TYPE_WORK', 'PHONE_TYPE_HOME')]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter, keyModeFilter},
+		},
+		{
+			name:    "unknown enum value in a list",
+			query:   "/people/phones[@type in ('PHONE_TYPE_WORK', 'PHONE_TYPE_WROK')]",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "single-element membership type mismatch",
+			query:   "/people[@name in (1)]",
+			md:      abDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "membership type mismatch",
+			query:   "/people[@name in (1, 2)]",
+			md:      abDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:      "bytes comparison",
+			query:     "/items[@bytes >= hex'616263' && bytes-length(@bytes) = 3]",
+			md:        scalarsDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "bytes compared to a string",
+			query:   "/items[@bytes = 'abc']",
+			md:      scalarsDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:      "timestamp comparison",
+			query:     "/people[@last_updated > '2024-01-01T00:00:00Z' && now() - @last_updated < '24h']",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "invalid timestamp literal",
+			query:   "/people[@last_updated > '2024-01-01']",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "invalid duration literal",
+			query:   "/people[now() - @last_updated < '1 day']",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:    "timestamp compared to a duration",
+			query:   "/people[@last_updated > now() - @last_updated]",
+			md:      abDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "sum of the timestamps",
+			query:   "/people[@last_updated + now() > '24h']",
+			md:      abDescr,
+			wantErr: ErrInvalidType,
+		},
+		{
+			name:      "wrapper comparison",
+			query:     "/profiles[@nickname = 'bob' && @age > 18]",
+			md:        profilesDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:      "wrapper value step",
+			query:     "/profiles/nickname/value",
+			md:        profilesDescr,
+			wantModes: []keyMode{},
+		},
+		{
+			name:    "wrapper type mismatch",
+			query:   "/profiles[@verified > 1]",
+			md:      profilesDescr,
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:      "sub-path",
+			query:     "/people[phones/type = 'PHONE_TYPE_WORK']/phones[../@name = 'John']",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter, keyModeFilter},
+		},
+		{
+			name:      "negated sub-path",
+			query:     "/people[!phones]",
+			md:        abDescr,
+			wantModes: []keyMode{keyModeFilter},
+		},
+		{
+			name:    "unknown node in a sub-path",
+			query:   "/people[phones/tpe = 'PHONE_TYPE_WORK']",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown property in a sub-path predicate",
+			query:   "/people[phones[@tpe]]",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown node in an absolute path",
+			query:   "/people[@name = $root/people[0]/nme]",
+			md:      abDescr,
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "key step on a scalar",
+			query:   "/people/id[0]",
+			md:      abDescr,
+			wantErr: ErrUnsupportedKey,
+		},
+		{
+			name:    "incompatible map key",
+			query:   "/messages_with_map/string_string_map[1]",
+			md:      mapDescr,
+			wantErr: ErrKeyCast,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq, err := CompileFor(tt.query, tt.md)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CompileFor() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompileFor() error = %v, no error expected", err)
+			}
+			modes := []keyMode{}
+			for _, step := range pq.tree.path {
+				if ks, ok := step.(*KeyQueryStep); ok {
+					modes = append(modes, ks.mode)
+				}
+			}
+			if !deepEqual(modes, tt.wantModes) {
+				t.Fatalf("KeyQueryStep modes = %+v, want %+v", modes, tt.wantModes)
+			}
+		})
+	}
+}
+
+func TestCompileForExpression(t *testing.T) {
+	abDescr := (&proto.AddressBook{}).ProtoReflect().Descriptor()
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr error
+	}{
+		{
+			name:  "absolute path",
+			query: "count(/people/phones) + 1",
+		},
+		{
+			name:  "relative path",
+			query: "count(people[@name = 'John'])",
+		},
+		{
+			name:  "arithmetic over an aggregate",
+			query: "max(/people/id) - min(/people/id) + 1",
+		},
+		{
+			name:    "unknown node in a path",
+			query:   "count(/people/nme)",
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown node in a relative path",
+			query:   "sum(people/phones/tpe)",
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:    "unknown property in a path predicate",
+			query:   "count(/people[@nme = 'John'])",
+			wantErr: ErrFieldNotFound,
+		},
+		{
+			name:  "path with variables",
+			query: "count(/people[@id > $min]/phones)",
+		},
+		{
+			name:    "unknown node in a path with variables",
+			query:   "count(/people[@id > $min]/nme)",
+			wantErr: ErrFieldNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileFor(tt.query, abDescr)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CompileFor() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompileFor() error = %v, no error expected", err)
+			}
+		})
+	}
+}
+
+func TestCompileForFindAll(t *testing.T) {
+	ab := &proto.AddressBook{
+		People: []*proto.Person{
+			{
+				Name: "Alice",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "123456", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+			{
+				Name: "John",
+				Phones: []*proto.Person_PhoneNumber{
+					{Number: "223456", Type: proto.PhoneType_PHONE_TYPE_MOBILE},
+					{Number: "223458", Type: proto.PhoneType_PHONE_TYPE_WORK},
+				},
+			},
+		},
+	}
+
+	pq, err := CompileFor(
+		"/people[@name='John']/phones[@type='PHONE_TYPE_WORK'][0]/number",
+		ab.ProtoReflect().Descriptor(),
+	)
+	if err != nil {
+		t.Fatalf("CompileFor() error = %v, no error expected", err)
+	}
+	if res, want := pq.FindAll(ab), []any{"223458"}; !deepEqual(res, want) {
+		t.Fatalf("FindAll() = %+v, want %+v", res, want)
+	}
+
+	_, err = pq.FindAllE(&proto.Bookstore{})
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("FindAllE() error = %v, want %v", err, ErrTypeMismatch)
+	}
+}
@@ -5,6 +5,8 @@ import protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 type TmpList struct {
 	descr    protoreflect.FieldDescriptor
 	elements []protoreflect.Value
+	// origin keeps the indices of the elements in the original list.
+	origin []int
 }
 
 var _ protoreflect.List = (*TmpList)(nil)
@@ -13,6 +15,7 @@ func NewTmpList(descr protoreflect.FieldDescriptor) *TmpList {
 	return &TmpList{
 		descr:    descr,
 		elements: make([]protoreflect.Value, 0),
+		origin:   make([]int, 0),
 	}
 }
 
@@ -25,7 +28,18 @@ func (tl *TmpList) Get(i int) protoreflect.Value {
 }
 
 func (tl *TmpList) Append(v protoreflect.Value) {
+	tl.appendAt(v, len(tl.elements))
+}
+
+// appendAt appends the value and keeps track of its index in the original list.
+func (tl *TmpList) appendAt(v protoreflect.Value, origin int) {
 	tl.elements = append(tl.elements, v)
+	tl.origin = append(tl.origin, origin)
+}
+
+// Origin returns the index of the i-th element in the original list.
+func (tl *TmpList) Origin(i int) int {
+	return tl.origin[i]
 }
 
 func (tl *TmpList) Set(i int, v protoreflect.Value) {
@@ -34,6 +48,7 @@ func (tl *TmpList) Set(i int, v protoreflect.Value) {
 
 func (tl *TmpList) Truncate(n int) {
 	tl.elements = tl.elements[:n]
+	tl.origin = tl.origin[:n]
 }
 
 func (tl *TmpList) AppendMutable() protoreflect.Value {
@@ -1,8 +1,11 @@
 package protoquery
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type TokenKind byte
@@ -13,6 +16,8 @@ const (
 	TokenAt           TokenKind = '@'
 	TokenBang         TokenKind = '!'
 	TokenBool         TokenKind = 'B' // Bool is a pseudo-token that represents a boolean.
+	TokenBytes        TokenKind = 'b' // Bytes is a pseudo-token that represents a hex'..' or a b64'..' literal.
+	TokenColon        TokenKind = 'C' // Colon is a pseudo-token that separates the slice bounds, e.g.: [1:3].
 	TokenComma        TokenKind = ','
 	TokenDot          TokenKind = '.'
 	TokenDotDot       TokenKind = ':' // DotDot is a pseudo-token that represents a double dot.
@@ -26,10 +31,12 @@ const (
 	TokenLParen       TokenKind = '('
 	TokenLess         TokenKind = '<'
 	TokenLessEqual    TokenKind = 'L' // LessEqual is a pseudo-token that represents a less than or equal operator.
+	TokenMatch        TokenKind = '~' // Match is a pseudo-token that represents a regular expression match operator.
 	TokenMinus        TokenKind = '-'
 	TokenNode         TokenKind = 'N' // Node is a pseudo-token that represents a node.
 	TokenInt          TokenKind = '0' // Number is a pseudo-token that represents an integer.
 	TokenOr           TokenKind = 'O' // Or is a pseudo-token that represents a logical OR operator.
+	TokenPercent      TokenKind = '%'
 	TokenPipe         TokenKind = '|'
 	TokenPlus         TokenKind = '+'
 	TokenRBracket     TokenKind = ']'
@@ -39,6 +46,7 @@ const (
 	TokenSlashSlash   TokenKind = '\\' // SlashSlash is a pseudo-token that represents a double slash.
 	TokenStar         TokenKind = '*'
 	TokenString       TokenKind = 'S' // String is a pseudo-token that represents a string.
+	TokenVariable     TokenKind = '$' // Variable is a $-prefixed name, the value holds the name.
 )
 
 type Token struct {
@@ -70,6 +78,15 @@ func (t *Token) IntValue() (int64, error) {
 	return ix, nil
 }
 
+// UintValue parses the integer literal which overflows int64, e.g.:
+// 18446744073709551615.
+func (t *Token) UintValue() (uint64, error) {
+	if t.Kind != TokenInt {
+		return 0, fmt.Errorf("Token is not a number: %v", t.Kind)
+	}
+	return strconv.ParseUint(t.Value, 10, 64)
+}
+
 func (t *Token) FloatValue() (float64, error) {
 	if t.Kind != TokenFloat {
 		return 0, fmt.Errorf("Token is not a number: %v", t.Kind)
@@ -81,6 +98,29 @@ func (t *Token) FloatValue() (float64, error) {
 	return fx, nil
 }
 
+// BytesValue decodes the bytes literal, e.g.: `hex'deadbeef'` or `b64'3q2+7w=='`.
+func (t *Token) BytesValue() ([]byte, error) {
+	if t.Kind != TokenBytes {
+		return nil, fmt.Errorf("Token is not a bytes literal: %v", t.Kind)
+	}
+	enc, quoted, _ := strings.Cut(t.Value, t.Value[len(t.Value)-1:])
+	data := strings.TrimSuffix(quoted, t.Value[len(t.Value)-1:])
+	var b []byte
+	var err error
+	switch enc {
+	case "hex":
+		b, err = hex.DecodeString(data)
+	case "b64":
+		b, err = base64.StdEncoding.DecodeString(data)
+	default:
+		return nil, fmt.Errorf("Unknown bytes literal encoding %q", enc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %v literal %v: %w", ErrInvalidType, enc, t.Value, err)
+	}
+	return b, nil
+}
+
 func (t *Token) BoolValue() (bool, error) {
 	if t.Kind != TokenBool {
 		return false, fmt.Errorf("Token is not a boolean: %v", t.Kind)
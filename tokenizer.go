@@ -25,14 +25,44 @@ func readNumber(s string, ix int) (string, int, bool) {
 	return s[start:ix], ix, isf
 }
 
+// readString reads the quoted string starting at ix. It returns the string
+// without the quotes. A doubled quote stands for the quote itself, like in
+// XPath 2.0.
+func readString(s string, ix int) (string, int, error) {
+	start := ix
+	end := s[ix] // we're looking for the matching quote
+	ix++
+	var b strings.Builder
+	for {
+		for ix < len(s) && s[ix] != end {
+			b.WriteByte(s[ix])
+			ix++
+		}
+		if ix >= len(s) {
+			return "", ix, fmt.Errorf("Unterminated string at position %d", start)
+		}
+		if ix+1 >= len(s) || s[ix+1] != end {
+			return b.String(), ix + 1, nil
+		}
+		b.WriteByte(end)
+		ix += 2
+	}
+}
+
 func readNode(s string, ix int) (string, int) {
 	start := ix
-	for ix < len(s) && (isAlpha(s, ix) || (ix-start > 0 && isDigit(s, ix))) {
+	for ix < len(s) && (isAlpha(s, ix) || (ix-start > 0 && isDigit(s, ix)) || isInnerHyphen(s, ix)) {
 		ix++
 	}
 	return s[start:ix], ix
 }
 
+// isInnerHyphen returns true if the hyphen joins the name parts, like in
+// XPath function names, e.g.: `starts-with`. Use spaces for subtraction.
+func isInnerHyphen(s string, ix int) bool {
+	return match(s, ix, TokenMinus) && ix > 0 && (isAlpha(s, ix-1) || isDigit(s, ix-1)) && isAlpha(s, ix+1)
+}
+
 func match(s string, ix int, ch TokenKind) bool {
 	return ix < len(s) && s[ix] == byte(ch)
 }
@@ -80,11 +110,13 @@ func tokenizeXPathQuery(query string) ([]*Token, error) {
 			ix++
 			tokens = append(tokens, NewToken(query[start:ix], tk))
 		} else if match(query, ix, TokenBang) {
-			if !match(query, ix+1, TokenEqual) {
-				return nil, fmt.Errorf("expected !=, got %v", query[ix])
+			tk := TokenBang
+			if match(query, ix+1, TokenEqual) {
+				tk = TokenNotEqual
+				ix++
 			}
-			ix += 2
-			tokens = append(tokens, NewToken(query[start:ix], TokenNotEqual))
+			ix++
+			tokens = append(tokens, NewToken(query[start:ix], tk))
 		} else if match(query, ix, TokenDot) {
 			tk := TokenDot
 			if len(query) > ix && match(query, ix+1, TokenDot) {
@@ -95,7 +127,7 @@ func tokenizeXPathQuery(query string) ([]*Token, error) {
 			tokens = append(tokens, NewToken(query[start:ix], tk))
 		} else if match(query, ix, TokenAnd) {
 			if !match(query, ix+1, TokenAnd) {
-				return nil, fmt.Errorf("expected &&, got %v", query[ix])
+				return nil, fmt.Errorf("expected &&, got %q", query[start:ix+1])
 			}
 			ix += 2
 			tokens = append(tokens, NewToken(query[start:ix], TokenAnd))
@@ -107,9 +139,22 @@ func tokenizeXPathQuery(query string) ([]*Token, error) {
 				ix += 1
 				tokens = append(tokens, NewToken(query[start:ix], TokenPipe))
 			}
+		} else if match(query, ix, TokenVariable) {
+			var name string
+			name, ix = readNode(query, ix+1)
+			if name == "" {
+				return nil, fmt.Errorf("expected variable name at position %d", ix)
+			}
+			tokens = append(tokens, NewToken(name, TokenVariable))
+		} else if query[ix] == ':' {
+			ix++
+			tokens = append(tokens, NewToken(query[start:ix], TokenColon))
 		} else if match(query, ix, TokenAt) {
 			ix++
 			tokens = append(tokens, NewToken(query[start:ix], TokenAt))
+		} else if match(query, ix, TokenEqual) && match(query, ix+1, TokenMatch) {
+			ix += 2
+			tokens = append(tokens, NewToken(query[start:ix], TokenMatch))
 		} else if matchAny(query, ix, TokenLess, TokenGreater) {
 			tk := TokenKind(query[ix])
 			ix++
@@ -119,25 +164,28 @@ func tokenizeXPathQuery(query string) ([]*Token, error) {
 			}
 			tokens = append(tokens, NewToken(query[start:ix], tk))
 		} else if matchAny(query, ix, TokenLBracket, TokenRBracket, TokenLParen,
-			TokenRParen, TokenStar, TokenEqual, TokenMinus, TokenPlus) {
+			TokenRParen, TokenStar, TokenEqual, TokenMinus, TokenPlus, TokenComma, TokenPercent) {
 			tokens = append(tokens, NewToken(query[ix:ix+1], TokenKind(query[ix])))
 			ix++
 		} else if matchAny(query, ix, TokenSingleQuote, TokenDoubleQuote) {
-			end := query[ix] // we're looking for the matching quote
-			ix++
-			for ix < len(query) && query[ix] != end {
-				ix++
+			var str string
+			var err error
+			if str, ix, err = readString(query, ix); err != nil {
+				return nil, err
 			}
-			if query[ix] != end {
-				return nil, fmt.Errorf("Unterminated string at position %d", ix)
-			}
-			tokens = append(tokens, NewToken(query[start+1:ix], TokenString))
-			ix++
+			tokens = append(tokens, NewToken(str, TokenString))
 		} else if isAlpha(query, ix) {
 			var node string
 			node, ix = readNode(query, ix)
 			lvalue := strings.ToLower(node)
-			if lvalue == "true" || lvalue == "false" {
+			if (node == "hex" || node == "b64") && matchAny(query, ix, TokenSingleQuote, TokenDoubleQuote) {
+				// The bytes literal is decoded by the parser.
+				var err error
+				if _, ix, err = readString(query, ix); err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, NewToken(query[start:ix], TokenBytes))
+			} else if lvalue == "true" || lvalue == "false" {
 				tokens = append(tokens, NewToken(node, TokenBool))
 			} else {
 				tokens = append(tokens, NewToken(node, TokenNode))
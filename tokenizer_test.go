@@ -1,6 +1,7 @@
 package protoquery
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -41,6 +42,91 @@ func TestTokenizeXPathQuery(t *testing.T) {
 			input: "@",
 			want:  []*Token{NewToken("@", TokenAt)},
 		},
+		{
+			name:  "bang",
+			input: "!",
+			want:  []*Token{NewToken("!", TokenBang)},
+		},
+		{
+			name:  "hyphenated function call",
+			input: "starts-with(@a, 'b')",
+			want: []*Token{
+				NewToken("starts-with", TokenNode),
+				NewToken("(", TokenLParen),
+				NewToken("@", TokenAt),
+				NewToken("a", TokenNode),
+				NewToken(",", TokenComma),
+				NewToken("b", TokenString),
+				NewToken(")", TokenRParen),
+			},
+		},
+		{
+			name:  "subtraction is not a hyphen",
+			input: "a - b-1",
+			want: []*Token{
+				NewToken("a", TokenNode),
+				NewToken("-", TokenMinus),
+				NewToken("b", TokenNode),
+				NewToken("-", TokenMinus),
+				NewToken("1", TokenInt),
+			},
+		},
+		{
+			name:  "slice",
+			input: "[1:-1]",
+			want: []*Token{
+				NewToken("[", TokenLBracket),
+				NewToken("1", TokenInt),
+				NewToken(":", TokenColon),
+				NewToken("-", TokenMinus),
+				NewToken("1", TokenInt),
+				NewToken("]", TokenRBracket),
+			},
+		},
+		{
+			name:  "match operator",
+			input: "@a =~ 'b'",
+			want: []*Token{
+				NewToken("@", TokenAt),
+				NewToken("a", TokenNode),
+				NewToken("=~", TokenMatch),
+				NewToken("b", TokenString),
+			},
+		},
+		{
+			name:  "bytes literals",
+			input: "hex'deadbeef' = b64\"3q2+7w==\"",
+			want: []*Token{
+				NewToken("hex'deadbeef'", TokenBytes),
+				NewToken("=", TokenEqual),
+				NewToken("b64\"3q2+7w==\"", TokenBytes),
+			},
+		},
+		{
+			name:  "modulo operator",
+			input: "@a % 2",
+			want: []*Token{
+				NewToken("@", TokenAt),
+				NewToken("a", TokenNode),
+				NewToken("%", TokenPercent),
+				NewToken("2", TokenInt),
+			},
+		},
+		{
+			name:    "unterminated string",
+			input:   "@a = 'b",
+			wantErr: fmt.Errorf("Unterminated string at position 5"),
+		},
+		{
+			name:  "variable",
+			input: "$root",
+			want:  []*Token{NewToken("root", TokenVariable)},
+		},
+		{
+			name:    "variable without a name",
+			input:   "$ ",
+			wantErr: fmt.Errorf("expected variable name at position 1"),
+		},
 		{
 			name:  "single quoted string",
 			input: "'string'",
@@ -51,6 +137,26 @@ func TestTokenizeXPathQuery(t *testing.T) {
 			input: "\"string\"",
 			want:  []*Token{NewToken("string", TokenString)},
 		},
+		{
+			name:  "empty string",
+			input: "''",
+			want:  []*Token{NewToken("", TokenString)},
+		},
+		{
+			name:  "escaped single quote",
+			input: "'it''s'",
+			want:  []*Token{NewToken("it's", TokenString)},
+		},
+		{
+			name:  "escaped double quote",
+			input: "\"say \"\"hi\"\"\"",
+			want:  []*Token{NewToken("say \"hi\"", TokenString)},
+		},
+		{
+			name:    "unterminated string with an escaped quote",
+			input:   "@a = 'b''",
+			wantErr: fmt.Errorf("Unterminated string at position 5"),
+		},
 		{
 			name:  "number",
 			input: "123.45",
@@ -0,0 +1,291 @@
+package protoquery
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"time"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The well-known message types unwrapped into the native values.
+const (
+	timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+	durationName  protoreflect.FullName = "google.protobuf.Duration"
+)
+
+// wrapperTypes maps the wrapper well-known messages to the types of the
+// wrapped values. The wrappers behave like nullable scalars.
+var wrapperTypes = map[protoreflect.FullName]Type{
+	"google.protobuf.DoubleValue": TypeFloat,
+	"google.protobuf.FloatValue":  TypeFloat,
+	"google.protobuf.Int64Value":  TypeInt,
+	"google.protobuf.Int32Value":  TypeInt,
+	"google.protobuf.UInt64Value": TypeUint,
+	"google.protobuf.UInt32Value": TypeUint,
+	"google.protobuf.BoolValue":   TypeBool,
+	"google.protobuf.StringValue": TypeString,
+	"google.protobuf.BytesValue":  TypeBytes,
+}
+
+// isTimeType returns true for the timestamp and the duration types.
+func isTimeType(typ Type) bool {
+	return typ == TypeTimestamp || typ == TypeDuration
+}
+
+// wellKnownType returns the expression type of the well-known message. It
+// returns false if the message is not unwrapped.
+func wellKnownType(md protoreflect.MessageDescriptor) (Type, bool) {
+	switch md.FullName() {
+	case timestampName:
+		return TypeTimestamp, true
+	case durationName:
+		return TypeDuration, true
+	}
+	typ, ok := wrapperTypes[md.FullName()]
+	return typ, ok
+}
+
+// wrappedValue returns the value held by the wrapper message. It returns
+// false if the message is not a wrapper.
+func wrappedValue(msg protoreflect.Message) (protoreflect.Value, bool) {
+	if _, ok := wrapperTypes[msg.Descriptor().FullName()]; !ok {
+		return protoreflect.Value{}, false
+	}
+	return msg.Get(msg.Descriptor().Fields().ByName("value")), true
+}
+
+// wellKnownFieldType returns the expression type of the singular well-known
+// message field.
+func wellKnownFieldType(fd protoreflect.FieldDescriptor) (Type, bool) {
+	if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+		return TypeUnknown, false
+	}
+	return wellKnownType(fd.Message())
+}
+
+// isWrapperField returns true for the singular wrapper message fields.
+func isWrapperField(fd protoreflect.FieldDescriptor) bool {
+	typ, ok := wellKnownFieldType(fd)
+	return ok && !isTimeType(typ)
+}
+
+// wellKnownValue unwraps the well-known message into the expression value
+// along with its type (see unwrapMessage). It returns false if the message
+// is not unwrapped.
+func wellKnownValue(msg protoreflect.Message) (any, Type, bool) {
+	v, ok := unwrapMessage(msg)
+	if !ok {
+		return nil, TypeUnknown, false
+	}
+	return scalarValue(v)
+}
+
+// unwrapMessage unwraps the well-known message: a Timestamp becomes a
+// time.Time, a Duration becomes a time.Duration and a wrapper becomes the
+// wrapped Go value, e.g.: a string for StringValue. It returns false if the
+// message is not unwrapped.
+func unwrapMessage(msg protoreflect.Message) (any, bool) {
+	if v, ok := wrappedValue(msg); ok {
+		return v.Interface(), true
+	}
+	fields := msg.Descriptor().Fields()
+	switch msg.Descriptor().FullName() {
+	case timestampName:
+		secs := msg.Get(fields.ByName("seconds")).Int()
+		nanos := msg.Get(fields.ByName("nanos")).Int()
+		return time.Unix(secs, nanos).UTC(), true
+	case durationName:
+		secs := msg.Get(fields.ByName("seconds")).Int()
+		nanos := msg.Get(fields.ByName("nanos")).Int()
+		return toDuration(secs, nanos), true
+	}
+	return nil, false
+}
+
+// wellKnownMessage wraps the time value into the well-known message. It
+// returns false if the value is not a time value.
+func wellKnownMessage(v any) (protoreflect.Message, bool) {
+	switch vv := v.(type) {
+	case time.Time:
+		return timestamppb.New(vv).ProtoReflect(), true
+	case time.Duration:
+		return durationpb.New(vv).ProtoReflect(), true
+	}
+	return nil, false
+}
+
+// toDuration converts the Duration message fields to a time.Duration. The
+// durations beyond the time.Duration range (roughly 292 years) saturate,
+// like time.Time.Sub does.
+func toDuration(secs, nanos int64) time.Duration {
+	const maxSecs = math.MaxInt64 / int64(time.Second)
+	switch {
+	case secs > maxSecs:
+		return math.MaxInt64
+	case secs < -maxSecs:
+		return math.MinInt64
+	}
+	d := secs * int64(time.Second)
+	switch {
+	case nanos > 0 && d > math.MaxInt64-nanos:
+		return math.MaxInt64
+	case nanos < 0 && d < math.MinInt64-nanos:
+		return math.MinInt64
+	}
+	return time.Duration(d + nanos)
+}
+
+// timeOperand returns the time value as is. A string is parsed as a value of
+// the given type: an RFC 3339 timestamp, e.g.: '2024-01-01T00:00:00Z', or a
+// duration, e.g.: '1h30m'.
+func timeOperand(v any, typ Type) (any, error) {
+	switch vv := v.(type) {
+	case time.Time, time.Duration:
+		return vv, nil
+	case string:
+		switch typ {
+		case TypeTimestamp:
+			t, err := time.Parse(time.RFC3339Nano, vv)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid timestamp %q, want RFC 3339", ErrInvalidType, vv)
+			}
+			return t, nil
+		case TypeDuration:
+			d, err := time.ParseDuration(vv)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid duration %q", ErrInvalidType, vv)
+			}
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %T, want %v", ErrInvalidType, v, TypeToStr[typ])
+}
+
+// timeValueType returns the type of the time value, or TypeUnknown if the
+// value is not a time value.
+func timeValueType(v any) Type {
+	switch v.(type) {
+	case time.Time:
+		return TypeTimestamp
+	case time.Duration:
+		return TypeDuration
+	}
+	return TypeUnknown
+}
+
+// timeArithType returns the result type of the time arithmetic. String
+// operands are duration literals, e.g.: `now() - '24h'`.
+func timeArithType(a, b Type, op Operator) (Type, error) {
+	if a == TypeString {
+		a = TypeDuration
+	}
+	if b == TypeString {
+		b = TypeDuration
+	}
+	switch {
+	case op == OpMinus && a == TypeTimestamp && b == TypeTimestamp:
+		return TypeDuration, nil
+	case (op == OpPlus || op == OpMinus) && a == TypeTimestamp && b == TypeDuration:
+		return TypeTimestamp, nil
+	case op == OpPlus && a == TypeDuration && b == TypeTimestamp:
+		return TypeTimestamp, nil
+	case (op == OpPlus || op == OpMinus) && a == TypeDuration && b == TypeDuration:
+		return TypeDuration, nil
+	}
+	return TypeUnknown, fmt.Errorf("%w: %v %v %v", ErrInvalidType, TypeToStr[a], OpToStr[op], TypeToStr[b])
+}
+
+// timeBinEval evaluates a binary expression over timestamps and durations.
+// In comparisons a string operand is parsed as a value of the other operand
+// type, in the arithmetic it is a duration literal.
+func timeBinEval(ctx EvalContext, a, b Expression, op Operator) (any, error) {
+	av, err := a.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bv, err := b.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		typ := cmp.Or(timeValueType(av), timeValueType(bv))
+		if av, err = timeOperand(av, typ); err != nil {
+			return nil, err
+		}
+		if bv, err = timeOperand(bv, typ); err != nil {
+			return nil, err
+		}
+		c, err := compareTimes(av, bv)
+		if err != nil {
+			return nil, err
+		}
+		return compareResult(op, c, true), nil
+	case OpPlus, OpMinus:
+		if av, err = timeOperand(av, TypeDuration); err != nil {
+			return nil, err
+		}
+		if bv, err = timeOperand(bv, TypeDuration); err != nil {
+			return nil, err
+		}
+		return timeArith(op, av, bv)
+	default:
+		return nil, fmt.Errorf("%w %v for %v operator", ErrInvalidType, TypeToStr[timeValueType(av)], OpToStr[op])
+	}
+}
+
+// compareTimes compares two timestamps or two durations.
+func compareTimes(a, b any) (int, error) {
+	switch av := a.(type) {
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return av.Compare(bv), nil
+		}
+	case time.Duration:
+		if bv, ok := b.(time.Duration); ok {
+			return cmp.Compare(av, bv), nil
+		}
+	}
+	return 0, fmt.Errorf("%w(%v Vs %v)", ErrTypeMismatch, TypeToStr[timeValueType(a)], TypeToStr[timeValueType(b)])
+}
+
+// timeArith computes the time arithmetic: the difference of two timestamps
+// is a duration, a timestamp shifted by a duration is a timestamp and the
+// durations add up like integers.
+func timeArith(op Operator, a, b any) (any, error) {
+	switch av := a.(type) {
+	case time.Time:
+		switch bv := b.(type) {
+		case time.Time:
+			if op == OpMinus {
+				return av.Sub(bv), nil
+			}
+		case time.Duration:
+			if op == OpMinus {
+				if bv == math.MinInt64 {
+					return nil, fmt.Errorf("%w: %v - %v", ErrOverflow, av, bv)
+				}
+				bv = -bv
+			}
+			return av.Add(bv), nil
+		}
+	case time.Duration:
+		switch bv := b.(type) {
+		case time.Time:
+			if op == OpPlus {
+				return bv.Add(av), nil
+			}
+		case time.Duration:
+			d, err := intArith(op, int64(av), int64(bv))
+			if err != nil {
+				return nil, err
+			}
+			return time.Duration(d), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v %v %v", ErrInvalidType, TypeToStr[timeValueType(a)], OpToStr[op], TypeToStr[timeValueType(b)])
+}
@@ -0,0 +1,37 @@
+package protoquery
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestWellKnownDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *durationpb.Duration
+		want time.Duration
+	}{
+		{name: "zero", msg: &durationpb.Duration{}, want: 0},
+		{name: "seconds and nanos", msg: &durationpb.Duration{Seconds: 90, Nanos: 5e8}, want: 90*time.Second + 500*time.Millisecond},
+		{name: "negative", msg: &durationpb.Duration{Seconds: -1, Nanos: -5e8}, want: -1500 * time.Millisecond},
+		{name: "max", msg: &durationpb.Duration{Seconds: 9223372036, Nanos: 854775807}, want: math.MaxInt64},
+		{name: "saturated nanos", msg: &durationpb.Duration{Seconds: 9223372036, Nanos: 999999999}, want: math.MaxInt64},
+		{name: "saturated seconds", msg: &durationpb.Duration{Seconds: math.MaxInt64}, want: math.MaxInt64},
+		{name: "saturated negative", msg: &durationpb.Duration{Seconds: -315576000000}, want: math.MinInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, typ, ok := wellKnownValue(tt.msg.ProtoReflect())
+			if !ok || typ != TypeDuration {
+				t.Fatalf("wellKnownValue() type = %v, %v, want %v", TypeToStr[typ], ok, TypeToStr[TypeDuration])
+			}
+			if v != tt.want {
+				t.Errorf("wellKnownValue() = %v, want %v", v, tt.want)
+			}
+		})
+	}
+}